@@ -0,0 +1,17 @@
+package pidfile
+
+import (
+	"strings"
+)
+
+// bootIDPath is where Linux exposes a random ID that is generated anew each time the system boots.
+var bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// readBootID returns the ID of the current boot, or the empty string if it cannot be determined.
+func readBootID() string {
+	d, err := readFile(osFileSystem{}, bootIDPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(d))
+}
@@ -0,0 +1,18 @@
+package pidfile
+
+import (
+	"time"
+)
+
+// A Clock tells a PidfileLock what time it is.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+var _ Clock = realClock{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,193 @@
+package pidfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Meta is information recorded in a pidfile alongside the pid.  Some keys are used by this package: "hostname" (see
+// WithHostname) and "boot_id" (see WithBootID).
+type Meta map[string]string
+
+// A PidfileCodec serializes the contents of a pidfile.
+type PidfileCodec interface {
+	// Encode writes pid and meta to w.
+	Encode(w io.Writer, pid Pid, meta Meta) error
+	// Decode reads a pid and its metadata from r.  Errors caused by the contents of the pidfile, as opposed to failures
+	// to read it, should wrap ErrMalformedPidfile.
+	Decode(r io.Reader) (Pid, Meta, error)
+}
+
+// textCodec is the default PidfileCodec.  It writes the pid on the first line, so that tools that only expect a pid
+// can read it, and any metadata on the following lines as key=value pairs.  A pidfile without metadata contains only
+// the pid.
+//
+// So that it can read pidfiles written by other tools, Decode only requires that the pidfile begin with a pid.
+// Anything that follows the pid on the first line, and any following line that is not a key=value pair, is ignored.
+type textCodec struct {
+	terminator string
+	// pidFormat is the fmt format with which the pid is written, or empty for "%d"; see WithPidFormat.
+	pidFormat string
+}
+
+var _ PidfileCodec = textCodec{}
+
+func (c textCodec) Encode(w io.Writer, pid Pid, meta Meta) error {
+	pidFormat := c.pidFormat
+	if pidFormat == "" {
+		pidFormat = "%d"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, pidFormat, pid)
+	buf.WriteString(c.terminator)
+
+	if len(meta) != 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteString("\n")
+	}
+
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := meta[k]
+		if k == "" || strings.ContainsAny(k, "=\r\n") || strings.ContainsAny(v, "\r\n") {
+			return errors.Errorf("cannot encode pidfile metadata %q=%q", k, v)
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", k, v)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (c textCodec) Decode(r io.Reader) (Pid, Meta, error) {
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(d), []byte("\n"))
+
+	first := lines[0]
+	if fields := bytes.Fields(first); len(fields) != 0 {
+		first = fields[0]
+	}
+	pid, err := parsePid(first)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var meta Meta
+	for _, line := range lines[1:] {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		kv := bytes.SplitN(line, []byte("="), 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if meta == nil {
+			meta = Meta{}
+		}
+		meta[string(kv[0])] = string(kv[1])
+	}
+
+	return pid, meta, nil
+}
+
+// checkPidFormat returns an error unless format, as passed to WithPidFormat, contains exactly one decimal integer verb
+// and nothing else that would prevent Read from finding the pid.
+func checkPidFormat(format string) error {
+	verbs := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue
+		}
+		for i < len(format) && strings.IndexByte("+- 0.123456789", format[i]) != -1 {
+			i++
+		}
+		if i == len(format) || format[i] != 'd' {
+			return errors.Errorf("pid format %q may only contain %%d verbs", format)
+		}
+		verbs++
+	}
+	if verbs != 1 {
+		return errors.Errorf("pid format %q must contain exactly one %%d verb", format)
+	}
+
+	// Make sure that we can read back what the format produces.
+	const testPid = Pid(4213)
+	var buf bytes.Buffer
+	if err := (textCodec{pidFormat: format}).Encode(&buf, testPid, nil); err != nil {
+		return err
+	}
+	if pid, _, err := (textCodec{}).Decode(&buf); err != nil || pid != testPid {
+		return errors.Errorf("pid format %q does not produce a readable pid", format)
+	}
+	return nil
+}
+
+// checkTerminator returns an error unless the pid can be read back from a pidfile written with terminator t, as passed
+// to WithTerminator.
+func checkTerminator(t string) error {
+	const testPid = Pid(4213)
+	var buf bytes.Buffer
+	if err := (textCodec{terminator: t}).Encode(&buf, testPid, nil); err != nil {
+		return err
+	}
+	if pid, _, err := (textCodec{}).Decode(&buf); err != nil || pid != testPid {
+		return errors.Errorf("terminator %q does not produce a readable pid", t)
+	}
+	return nil
+}
+
+// jsonCodec is a PidfileCodec that writes a JSON object.
+type jsonCodec struct{}
+
+var _ PidfileCodec = jsonCodec{}
+
+// NewJSONCodec returns a PidfileCodec that writes the pid and its metadata as a JSON object, such as
+//
+//	{"pid":1234,"meta":{"hostname":"example"}}
+func NewJSONCodec() PidfileCodec {
+	return jsonCodec{}
+}
+
+// jsonPidfile is the JSON representation of a pidfile.
+type jsonPidfile struct {
+	Pid  int64 `json:"pid"`
+	Meta Meta  `json:"meta,omitempty"`
+}
+
+func (jsonCodec) Encode(w io.Writer, pid Pid, meta Meta) error {
+	return json.NewEncoder(w).Encode(jsonPidfile{Pid: int64(pid), Meta: meta})
+}
+
+func (jsonCodec) Decode(r io.Reader) (Pid, Meta, error) {
+	var v jsonPidfile
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		return 0, nil, errors.Wrapf(ErrMalformedPidfile, "pidfile does not contain valid JSON: %v", err)
+	}
+
+	pid, err := checkPid(v.Pid)
+	if err != nil {
+		return 0, nil, err
+	}
+	return pid, v.Meta, nil
+}
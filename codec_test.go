@@ -0,0 +1,150 @@
+package pidfile
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The text codec should read a pid and any metadata lines, ignoring what follows the pid on its line, and should
+// reject contents that do not start with a pid.
+func TestTextCodec_Decode(t *testing.T) {
+	for _, c := range []struct {
+		contents string
+		pid      Pid
+		meta     Meta
+	}{
+		{"1234", 1234, nil},
+		{"1234\n", 1234, nil},
+		{"1234\nhostname=foo\n", 1234, Meta{"hostname": "foo"}},
+		{"1234\r\nhostname=foo\r\n", 1234, Meta{"hostname": "foo"}},
+		{"1234\nhostname=foo\nsomething=else=again\n", 1234, Meta{"hostname": "foo", "something": "else=again"}},
+		{"1234 extra", 1234, nil},
+		{"1234\t1496318400 more\n", 1234, nil},
+		{"1234\nmetadata", 1234, nil},
+		{"1234\nmetadata\nhostname=foo", 1234, Meta{"hostname": "foo"}},
+	} {
+		pid, meta, err := textCodec{}.Decode(bytes.NewReader([]byte(c.contents)))
+		assert.Nil(t, err, "contents: %q", c.contents)
+		assert.Equal(t, c.pid, pid, "contents: %q", c.contents)
+		assert.Equal(t, c.meta, meta, "contents: %q", c.contents)
+	}
+
+	for _, contents := range []string{"", "extra 1234", "1234extra"} {
+		_, _, err := textCodec{}.Decode(bytes.NewReader([]byte(contents)))
+		assert.True(t, errors.Is(err, ErrMalformedPidfile), "contents %q: unexpected error: %v", contents, err)
+	}
+}
+
+// If metadata is recorded, the text codec should write it after the pid in key order, and should refuse keys and values
+// that could not be read back.
+func TestTextCodec_Encode(t *testing.T) {
+	var buf bytes.Buffer
+	err := textCodec{terminator: ""}.Encode(&buf, 1234, Meta{"b": "2", "a": "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "1234\na=1\nb=2\n", buf.String())
+
+	for _, meta := range []Meta{{"": "x"}, {"a=b": "x"}, {"a": "x\ny"}} {
+		assert.NotNil(t, textCodec{}.Encode(&buf, 1234, meta), "meta: %v", meta)
+	}
+}
+
+// A pid format should be accepted only if it formats the pid exactly once as a decimal integer that can be read back.
+func TestCheckPidFormat(t *testing.T) {
+	for _, format := range []string{"%d", "%010d", "%-10d", "%.8d", "% d", "%+d", "%d pid"} {
+		assert.Nil(t, checkPidFormat(format), "format %q", format)
+	}
+	for _, format := range []string{"", "pid", "%d %d", "%x", "%s", "%v", "%010", "pid=%d", "%%d", "%d%%"} {
+		assert.NotNil(t, checkPidFormat(format), "format %q", format)
+	}
+}
+
+// A terminator should be accepted only if the pid that it follows can still be read back.
+func TestCheckTerminator(t *testing.T) {
+	for _, term := range []string{"", "\n", "\r\n", " ", "\t# pid"} {
+		assert.Nil(t, checkTerminator(term), "terminator %q", term)
+	}
+	for _, term := range []string{";", "0", "x\n", "\x00"} {
+		assert.NotNil(t, checkTerminator(term), "terminator %q", term)
+	}
+}
+
+// A zero-padded pid should be read back as the same pid.
+func TestPidFormat(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	pidfile, err := New(pidfilePath, WithPidFormat("%010d"))
+	assert.Nil(t, err)
+	assert.Nil(t, pidfile.Write(4213))
+
+	d, err := ioutil.ReadFile(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "0000004213\n", string(d))
+
+	pid, _, err := pidfile.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(4213), pid)
+
+	_, err = New(pidfilePath, WithPidFormat("pid=%d"))
+	assert.NotNil(t, err)
+	_, err = NewLock(pidfilePath, WithPidFormat("%x"))
+	assert.NotNil(t, err)
+}
+
+// If the JSON codec is used, the pidfile should be a JSON object holding the pid and metadata, and anything else should
+// be malformed.
+func TestJSONCodec(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	pidfile, err := New(pidfilePath, WithCodec(NewJSONCodec()), WithMeta(Meta{"version": "1.2.3"}))
+	assert.Nil(t, err)
+
+	err = pidfile.Write(Pid(1234))
+	assert.Nil(t, err)
+
+	d, err := ioutil.ReadFile(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"pid":1234,"meta":{"version":"1.2.3"}}`+"\n", string(d))
+
+	pid, meta, _, err := pidfile.ReadMeta()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1234), pid)
+	assert.Equal(t, Meta{"version": "1.2.3"}, meta)
+
+	for _, s := range []string{"1234", `{"pid":0}`, `{"pid":-1}`, `{"pid":"1234"}`} {
+		_, _, err := NewJSONCodec().Decode(bytes.NewReader([]byte(s)))
+		assert.True(t, errors.Is(err, ErrMalformedPidfile), "contents %q: unexpected error: %v", s, err)
+	}
+}
+
+// The metadata that this package records should be readable alongside any set by the caller.
+func TestWithMeta(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	hostname, err := os.Hostname()
+	assert.Nil(t, err)
+
+	pidfile, err := New(pidfilePath, WithHostname(true), WithMeta(Meta{"hostname": "ignored", "version": "1.2.3"}))
+	assert.Nil(t, err)
+
+	err = pidfile.Write(Pid(1234))
+	assert.Nil(t, err)
+
+	pid, meta, _, err := pidfile.ReadMeta()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1234), pid)
+	assert.Equal(t, Meta{"hostname": hostname, "version": "1.2.3"}, meta)
+}
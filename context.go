@@ -0,0 +1,18 @@
+package pidfile
+
+import (
+	"context"
+)
+
+type lockContextKey struct{}
+
+// WithLock returns a copy of ctx that carries l.  Downstream code can retrieve it with LockFromContext.
+func WithLock(ctx context.Context, l PidfileLock) context.Context {
+	return context.WithValue(ctx, lockContextKey{}, l)
+}
+
+// LockFromContext returns the lock stored in ctx by WithLock, if any.
+func LockFromContext(ctx context.Context) (PidfileLock, bool) {
+	l, ok := ctx.Value(lockContextKey{}).(PidfileLock)
+	return l, ok
+}
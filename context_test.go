@@ -0,0 +1,27 @@
+package pidfile
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// If a lock has been attached to a context, LockFromContext should return it.
+func TestLockFromContext(t *testing.T) {
+	l, err := NewLock(tempfilename(t))
+	assert.Nil(t, err)
+
+	ctx := WithLock(context.Background(), l)
+
+	got, ok := LockFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, l, got)
+}
+
+// If no lock has been attached to a context, LockFromContext should say so.
+func TestLockFromContext_Absent(t *testing.T) {
+	got, ok := LockFromContext(context.Background())
+	assert.False(t, ok)
+	assert.Nil(t, got)
+}
@@ -0,0 +1,89 @@
+package pidfile
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The default PidfileLock, for programs that only have one pidfile.  It is created the first time that it is used, from
+// the path given to SetDefaultPath.
+var (
+	defaultMu          sync.Mutex
+	defaultPath        string
+	defaultOpts        []Option
+	defaultInitialized bool
+
+	defaultOnce sync.Once
+	defaultLock PidfileLock
+	defaultErr  error
+)
+
+// SetDefaultPath sets the path (and options) of the default pidfile, which is used by functions such as WriteDefault.
+// It must be called before the default pidfile is first used; afterwards, it returns an error.
+func SetDefaultPath(path string, opts ...Option) error {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultInitialized {
+		return errors.New("default pidfile is already in use")
+	}
+	defaultPath = path
+	defaultOpts = opts
+	return nil
+}
+
+// Default returns the default pidfile, creating it if necessary.  If SetDefaultPath was not called first, it returns an
+// error, and will continue to do so.
+func Default() (PidfileLock, error) {
+	defaultOnce.Do(func() {
+		defaultMu.Lock()
+		defer defaultMu.Unlock()
+
+		defaultInitialized = true
+		if defaultPath == "" {
+			defaultErr = errors.New("default pidfile path has not been set; call SetDefaultPath first")
+			return
+		}
+		defaultLock, defaultErr = NewLock(defaultPath, defaultOpts...)
+	})
+	return defaultLock, defaultErr
+}
+
+// WriteDefault writes the pid of the current process to the default pidfile.  See Pidfile.Write.
+func WriteDefault() error {
+	l, err := Default()
+	if err != nil {
+		return err
+	}
+	return l.Write(SelfPid)
+}
+
+// ReadDefault reads the default pidfile.  See Pidfile.Read.
+func ReadDefault() (Pid, time.Time, error) {
+	l, err := Default()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return l.Read()
+}
+
+// LockDefault takes the default pidfile's lock on behalf of the current process.  See PidfileLock.Lock.
+func LockDefault() error {
+	l, err := Default()
+	if err != nil {
+		return err
+	}
+	return l.Lock(SelfPid)
+}
+
+// UnlockDefault releases the default pidfile's lock, which must be held by the current process.  See
+// PidfileLock.Unlock.
+func UnlockDefault() error {
+	l, err := Default()
+	if err != nil {
+		return err
+	}
+	return l.Unlock(SelfPid)
+}
@@ -0,0 +1,77 @@
+package pidfile
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// resetDefault forgets the default pidfile, so that each test can start afresh.
+func resetDefault() {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultPath = ""
+	defaultOpts = nil
+	defaultInitialized = false
+	defaultOnce = sync.Once{}
+	defaultLock = nil
+	defaultErr = nil
+}
+
+// If a default path has been set, every caller should get the same default lock, and the path should not change.
+func TestDefault(t *testing.T) {
+	resetDefault()
+	defer resetDefault()
+
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	assert.Nil(t, SetDefaultPath(pidfilePath))
+
+	// Many goroutines using the default pidfile at once should all get the same one.
+	locks := make(chan PidfileLock, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(locks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := Default()
+			assert.Nil(t, err)
+			locks <- l
+		}()
+	}
+	wg.Wait()
+	close(locks)
+	first := <-locks
+	for l := range locks {
+		assert.True(t, first == l)
+	}
+
+	assert.NotNil(t, SetDefaultPath(pidfilePath+".other"))
+
+	assert.Nil(t, LockDefault())
+	pid, _, err := ReadDefault()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+	assert.Nil(t, UnlockDefault())
+
+	assert.Nil(t, WriteDefault())
+	pid, _, err = ReadDefault()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+}
+
+// If no default path has been set, using the default lock should fail.
+func TestDefault_NoPath(t *testing.T) {
+	resetDefault()
+	defer resetDefault()
+
+	_, err := Default()
+	assert.NotNil(t, err)
+	assert.NotNil(t, WriteDefault())
+}
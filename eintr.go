@@ -0,0 +1,56 @@
+package pidfile
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// retryEINTR calls fn until it returns something other than an error caused by EINTR.  Processes that manage daemons
+// tend to receive a lot of signals, and we would rather not surface an interrupted syscall as a spurious failure.
+func retryEINTR(fn func() error) error {
+	for {
+		err := fn()
+		if !isEINTR(err) {
+			return err
+		}
+	}
+}
+
+func isEINTR(err error) bool {
+	return err != nil && errors.Is(err, syscall.EINTR)
+}
+
+func readFile(fs FileSystem, path string) ([]byte, error) {
+	var d []byte
+	err := retryEINTR(func() error {
+		f, err := fs.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		d, err = ioutil.ReadAll(f)
+		return err
+	})
+	return d, err
+}
+
+func stat(fs FileSystem, path string) (os.FileInfo, error) {
+	var st os.FileInfo
+	err := retryEINTR(func() error {
+		var err error
+		st, err = fs.Stat(path)
+		return err
+	})
+	return st, err
+}
+
+func remove(fs FileSystem, path string) error {
+	return retryEINTR(func() error {
+		return fs.Remove(path)
+	})
+}
@@ -0,0 +1,41 @@
+package pidfile
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// An operation that is interrupted once should be retried and ultimately succeed, even if the EINTR is wrapped.
+func TestRetryEINTR(t *testing.T) {
+	for _, intr := range []error{
+		syscall.EINTR,
+		&os.PathError{Op: "open", Path: "/run/test.pid", Err: syscall.EINTR},
+		errors.Wrap(&os.SyscallError{Syscall: "rename", Err: syscall.EINTR}, "failed to close pidfile"),
+	} {
+		calls := 0
+		err := retryEINTR(func() error {
+			calls++
+			if calls == 1 {
+				return intr
+			}
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, calls)
+	}
+}
+
+// Errors other than EINTR should be returned immediately.
+func TestRetryEINTR_OtherError(t *testing.T) {
+	calls := 0
+	err := retryEINTR(func() error {
+		calls++
+		return syscall.EACCES
+	})
+	assert.Equal(t, syscall.EACCES, err)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,99 @@
+package pidfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMalformedPidfile is returned (wrapped) by Read when the pidfile does not contain a valid pid.  Callers can check
+// for it with errors.Is to decide, for example, to overwrite a corrupt pidfile.
+var ErrMalformedPidfile = errors.New("malformed pidfile")
+
+// ErrEmptyPidfile is returned (wrapped) by Read when the pidfile is empty or contains only whitespace, as when a
+// process that was writing it without doing so atomically crashed.  It also satisfies errors.Is(err,
+// ErrMalformedPidfile).  Such a pidfile never represents a valid lock, so Lock replaces it.
+var ErrEmptyPidfile = errors.WithMessage(ErrMalformedPidfile, "pidfile is empty")
+
+// ErrReadOnly is returned (wrapped) by Write when the Pidfile was returned by Open.
+var ErrReadOnly = errors.New("pidfile is read-only")
+
+// ErrLockHeld is returned by Lock when the lock is held by another process.  For compatibility with callers that
+// compared against the os.ErrExist that Lock used to return, it satisfies errors.Is(err, os.ErrExist).
+type ErrLockHeld struct {
+	// Pid is the pid of the process holding the lock.
+	Pid Pid
+	// Hostname is the host on which that process runs, if it was recorded in the pidfile (see WithHostname).
+	Hostname string
+}
+
+func (e *ErrLockHeld) Error() string {
+	if e.Hostname != "" {
+		return fmt.Sprintf("lock is held by pid %d on %s", e.Pid, e.Hostname)
+	}
+	return fmt.Sprintf("lock is held by pid %d", e.Pid)
+}
+
+func (e *ErrLockHeld) Is(target error) bool {
+	return target == os.ErrExist
+}
+
+// ErrNotOwner is returned by methods such as Unlock that may only be called by the holder of a lock, when the lock is
+// held by some other process.  Callers can detect it with errors.As.
+type ErrNotOwner struct {
+	// Holder is the pid of the process holding the lock.
+	Holder Pid
+	// Hostname is the host on which the holder runs, if that is not this host.
+	Hostname string
+	// Caller is the pid that the method was asked to act on behalf of, or zero if it acts on behalf of no particular
+	// process (as SendSignal does).
+	Caller Pid
+	// Op describes what was attempted, such as "released"; it completes "lock cannot be ... by".
+	Op string
+}
+
+func (e *ErrNotOwner) Error() string {
+	held := fmt.Sprintf("pidfile is held by %d", e.Holder)
+	if e.Hostname != "" {
+		held += " on " + e.Hostname
+	}
+	if e.Caller == 0 {
+		return fmt.Sprintf("%s; lock cannot be %s", held, e.Op)
+	}
+	return fmt.Sprintf("%s; lock cannot be %s by %d", held, e.Op, e.Caller)
+}
+
+// ErrCannotWrite is returned by Write (and so by Lock) when the pidfile or its parent directories cannot be created
+// because the process lacks permission to do so.  It satisfies errors.Is(err, os.ErrPermission).
+type ErrCannotWrite struct {
+	Path string
+	Err  error
+}
+
+func (e *ErrCannotWrite) Error() string {
+	return fmt.Sprintf("cannot write pidfile %v (check ownership and permissions of %v): %v",
+		e.Path, filepath.Dir(e.Path), e.Err)
+}
+
+func (e *ErrCannotWrite) Unwrap() error {
+	return e.Err
+}
+
+// ErrBadPath is returned by Write (and so by Lock) when the pidfile's path cannot be used at all: it is too long, or it
+// passes through a symbolic link loop.  Unlike most other failures, retrying will not help; the path must be fixed.
+// The underlying error is preserved, so errors.Is(err, syscall.ENAMETOOLONG) and errors.Is(err, syscall.ELOOP) also
+// work.
+type ErrBadPath struct {
+	Path string
+	Err  error
+}
+
+func (e *ErrBadPath) Error() string {
+	return fmt.Sprintf("bad pidfile path %v: %v", e.Path, e.Err)
+}
+
+func (e *ErrBadPath) Unwrap() error {
+	return e.Err
+}
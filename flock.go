@@ -0,0 +1,209 @@
+package pidfile
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// NewFlockLock returns a PidfileLock that, instead of comparing the pidfile's mtime against the creation time of the
+// process that it names, relies on an advisory lock (flock(2)) held on the pidfile for as long as the lock is held.
+// The pid is still written to the pidfile, but only for the benefit of humans and of methods such as Holder.
+//
+// Unlike the locks returned by NewLock, a flock-based lock is released by the kernel when its holder exits, and so is
+// never mistaken for valid after its pid is reused.  However, advisory locks are not reliable on every filesystem (in
+// particular, on some network filesystems), and they are not supported on Windows.
+//
+// Advisory locks are taken on the operating system's filesystem, so NewFlockLock cannot be used with WithFileSystem.
+//
+// The lock belongs to the returned PidfileLock: only that PidfileLock can Unlock it, and it cannot be handed off to or
+// stolen by another process.  Checking whether the lock is held momentarily takes a shared lock on the pidfile, which
+// can cause a concurrent Lock to report that the lock is held.
+func NewFlockLock(path string, opts ...Option) (PidfileLock, error) {
+	if !flockSupported {
+		return nil, errors.New("flock-based locks are not supported on this platform")
+	}
+
+	l, err := NewLock(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p := l.(*pidfileLock)
+	if _, ok := p.opts.fs.(osFileSystem); !ok {
+		return nil, errors.New("flock-based locks cannot be used with WithFileSystem")
+	}
+	p.useFlock = true
+	return p, nil
+}
+
+// errFlockNotSupported is returned by the methods that flock-based locks do not support.
+var errFlockNotSupported = errors.New("not supported by flock-based locks")
+
+// lockFlock is Lock for flock-based locks.  p.mu must be held.
+func (p *pidfileLock) lockFlock(pid Pid) error {
+	if p.flockFile != nil {
+		rec, _, err := p.read()
+		if err != nil {
+			return errors.Wrap(err, "failed to read pidfile")
+		}
+		return &ErrLockHeld{Pid: rec.pid, Hostname: rec.hostname}
+	}
+
+	if err := p.mkdirs(); err != nil {
+		return err
+	}
+
+	for i := 0; i < maxLockAttempts; i++ {
+		var f *os.File
+		created := false
+		if err := retryEINTR(func() error {
+			var err error
+			f, err = os.OpenFile(p.path, os.O_RDWR, 0)
+			if os.IsNotExist(err) {
+				f, err = os.OpenFile(p.path, os.O_RDWR|os.O_CREATE|os.O_EXCL, p.opts.fileMode)
+				created = err == nil
+			}
+			return err
+		}); err != nil {
+			if os.IsExist(err) {
+				// Someone else created the pidfile after we looked for it.
+				continue
+			}
+			if errors.Is(err, os.ErrPermission) {
+				return &ErrCannotWrite{Path: p.path, Err: err}
+			}
+			return errors.Wrapf(err, "error opening pidfile: %v", p.path)
+		}
+
+		ok, err := flockTryExclusive(f)
+		if err != nil {
+			_ = f.Close()
+			return errors.Wrapf(err, "failed to lock pidfile: %v", p.path)
+		}
+		if !ok {
+			_ = f.Close()
+			rec, _, err := p.read()
+			if isWrappedNotExist(err) {
+				// The holder released the lock after we opened the pidfile.
+				continue
+			}
+			// If the pidfile cannot be parsed, the holder may be in the middle of writing it; all we know is that the
+			// lock is held.
+			return &ErrLockHeld{Pid: rec.pid, Hostname: rec.hostname}
+		}
+
+		// The previous holder may have removed the pidfile after we opened it but before we locked it, in which case
+		// we hold a lock on a file that nobody else will ever look at.
+		if same, err := p.isPidfile(f); err != nil || !same {
+			_ = f.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// As with Write, the pidfile gets exactly the mode set by WithFileMode, which OpenFile's umask does not; but an
+		// existing pidfile keeps its mode if we have been asked to preserve it.
+		if created || !p.opts.preserveMode {
+			if err := f.Chmod(p.opts.fileMode); err != nil {
+				_ = f.Close()
+				return errors.Wrapf(err, "failed to set mode of pidfile: %v", p.path)
+			}
+		}
+
+		if err := p.writeLocked(f, pid); err != nil {
+			_ = f.Close()
+			return err
+		}
+		p.flockFile = f
+		p.log("lock.acquired", map[string]interface{}{"pid": pid})
+		return nil
+	}
+
+	return errors.Errorf("failed to acquire lock after %d attempts", maxLockAttempts)
+}
+
+// isPidfile returns true iff f is the file currently at the pidfile's path.
+func (p *pidfileLock) isPidfile(f *os.File) (bool, error) {
+	fst, err := f.Stat()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to stat pidfile: %v", p.path)
+	}
+	st, err := stat(p.opts.fs, p.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to stat pidfile: %v", p.path)
+	}
+	return os.SameFile(fst, st), nil
+}
+
+// writeLocked replaces the contents of f, which is the pidfile, with a record of pid.  It is written in place rather
+// than atomically replaced so that the flock held on f continues to apply to the pidfile.
+func (p *pidfileLock) writeLocked(f *os.File, pid Pid) error {
+	if err := checkWritePid(pid); err != nil {
+		return err
+	}
+	if err := p.checkAlive(pid); err != nil {
+		return err
+	}
+	d, err := p.format(pid)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return errors.Wrapf(err, "failed to truncate pidfile: %v", p.path)
+	}
+	if _, err := f.WriteAt(d, 0); err != nil {
+		return errors.Wrapf(err, "failed to write pid to pidfile: %v", p.path)
+	}
+	if p.opts.sync {
+		if err := f.Sync(); err != nil {
+			return errors.Wrapf(err, "failed to sync pidfile: %v", p.path)
+		}
+	}
+	return nil
+}
+
+// unlockFlock is Unlock for flock-based locks.  p.mu must be held.
+func (p *pidfileLock) unlockFlock(pid Pid) error {
+	rec, _, err := p.read()
+	if err != nil {
+		if isWrappedNotExist(err) {
+			return os.ErrNotExist
+		}
+		return errors.Wrap(err, "failed to read pid")
+	}
+
+	if p.flockFile == nil {
+		held, err := flockHeld(p.path)
+		if err != nil {
+			return errors.Wrap(err, "failed to validate lock")
+		}
+		if !held {
+			return os.ErrNotExist
+		}
+		return &ErrNotOwner{Holder: rec.pid, Caller: pid, Op: "released"}
+	}
+	if rec.pid != pid {
+		return &ErrNotOwner{Holder: rec.pid, Caller: pid, Op: "released"}
+	}
+
+	// Remove the pidfile before releasing the lock, so that nobody can lock it in between; anyone who opened it before
+	// it was removed will notice that it is no longer the pidfile once they lock it.
+	if err := remove(p.opts.fs, p.path); err != nil {
+		return errors.Wrap(err, "failed to remove pidfile")
+	}
+	p.releaseFlock()
+	p.log("lock.released", map[string]interface{}{"pid": pid})
+	return nil
+}
+
+// releaseFlock closes the pidfile that we hold locked, if any, which releases the lock.  p.mu must be held.
+func (p *pidfileLock) releaseFlock() {
+	if p.flockFile != nil {
+		_ = p.flockFile.Close()
+		p.flockFile = nil
+	}
+}
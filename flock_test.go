@@ -0,0 +1,101 @@
+//go:build !windows
+// +build !windows
+
+package pidfile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempFlockLock(t *testing.T) (PidfileLock, func()) {
+	dir, err := ioutil.TempDir("", "pidfile-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+
+	l, err := NewFlockLock(filepath.Join(dir, "test.pid"))
+	if err != nil {
+		t.Fatalf("failed to create PidfileLock: %v", err)
+	}
+	return l, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// If a flock-based lock is held, another handle on the same pidfile should neither take nor release it.
+func TestFlockLock(t *testing.T) {
+	l, cleanup := tempFlockLock(t)
+	defer cleanup()
+
+	assert.Nil(t, l.Lock(0))
+
+	pid, err := l.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+
+	held, err := l.QuickCheck()
+	assert.Nil(t, err)
+	assert.True(t, held)
+
+	// A second handle on the same pidfile does not share the first one's advisory lock.
+	other, err := NewFlockLock(l.Path())
+	assert.Nil(t, err)
+
+	err = other.Lock(0)
+	var heldErr *ErrLockHeld
+	if assert.True(t, errors.As(err, &heldErr), "unexpected error: %v", err) {
+		assert.Equal(t, Pid(os.Getpid()), heldErr.Pid)
+	}
+
+	err = other.Unlock(0)
+	assert.True(t, errors.As(err, new(*ErrNotOwner)), "unexpected error: %v", err)
+
+	assert.Nil(t, l.Unlock(0))
+	_, err = os.Stat(l.Path())
+	assert.True(t, os.IsNotExist(err), "pidfile exists when it should not")
+
+	assert.Nil(t, other.Lock(0))
+	assert.Nil(t, other.Unlock(0))
+}
+
+// A pidfile that nobody holds an advisory lock on is stale, even if the process that it names is running.
+func TestFlockLock_Stale(t *testing.T) {
+	l, cleanup := tempFlockLock(t)
+	defer cleanup()
+
+	pidfile, err := New(l.Path())
+	assert.Nil(t, err)
+	assert.Nil(t, pidfile.Write(0))
+
+	stale, err := l.IsStale()
+	assert.Nil(t, err)
+	assert.True(t, stale)
+
+	assert.Equal(t, os.ErrNotExist, l.Unlock(0))
+
+	assert.Nil(t, l.Lock(0))
+	pid, err := l.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+	assert.Nil(t, l.Unlock(0))
+}
+
+// If an operation cannot be done with an advisory lock, it should fail without disturbing the lock.
+func TestFlockLock_Unsupported(t *testing.T) {
+	l, cleanup := tempFlockLock(t)
+	defer cleanup()
+
+	assert.Nil(t, l.Lock(0))
+	assert.NotNil(t, l.HandOff(1))
+	assert.NotNil(t, l.Steal(1))
+
+	assert.Nil(t, l.ForceUnlock())
+	assert.Nil(t, l.Lock(0))
+	assert.Nil(t, l.Unlock(0))
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package pidfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// flockSupported is true iff NewFlockLock is supported on this platform.
+const flockSupported = true
+
+// flockTryExclusive tries to take an exclusive advisory lock on f without blocking, returning true iff it did so.
+func flockTryExclusive(f *os.File) (bool, error) {
+	err := retryEINTR(func() error {
+		return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	})
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// flockHeld returns true iff some process holds an exclusive advisory lock on the file at path.  If the file does not
+// exist, it returns false.
+func flockHeld(path string) (bool, error) {
+	var f *os.File
+	if err := retryEINTR(func() error {
+		var err error
+		f, err = os.Open(path)
+		return err
+	}); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	err := retryEINTR(func() error {
+		return syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	})
+	if err == syscall.EWOULDBLOCK {
+		return true, nil
+	}
+	return false, err
+}
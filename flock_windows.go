@@ -0,0 +1,16 @@
+package pidfile
+
+import (
+	"os"
+)
+
+// flockSupported is true iff NewFlockLock is supported on this platform.  Windows has no flock(2).
+const flockSupported = false
+
+func flockTryExclusive(f *os.File) (bool, error) {
+	return false, errFlockNotSupported
+}
+
+func flockHeld(path string) (bool, error) {
+	return false, errFlockNotSupported
+}
@@ -0,0 +1,217 @@
+package pidfile
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/facebookgo/atomicfile"
+	"github.com/pkg/errors"
+)
+
+// A FileSystem provides the filesystem operations that pidfiles need.  The default uses the operating system's
+// filesystem; another can be supplied with WithFileSystem, which is mostly useful for tests.
+//
+// Errors should be reported as the os package would report them, so that, for example, errors.Is(err, os.ErrNotExist)
+// holds when a file does not exist.
+type FileSystem interface {
+	Open(path string) (io.ReadCloser, error)
+	Stat(path string) (os.FileInfo, error)
+	Remove(path string) error
+	Rename(oldpath, newpath string) error
+	Link(oldpath, newpath string) error
+	Chtimes(path string, atime, mtime time.Time) error
+	Chmod(path string, mode os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+
+	// WriteFileAtomic replaces the file at path with one containing d, such that no reader can observe a partially
+	// written file.  The file's permissions must be exactly perm, regardless of the umask.  If sync is true, the file
+	// and its directory are flushed to stable storage before it returns.
+	WriteFileAtomic(path string, d []byte, perm os.FileMode, sync bool) error
+	// CreateFileExclusive is like WriteFileAtomic, but fails with an error satisfying errors.Is(err, os.ErrExist) if
+	// the file already exists, and sets the new file's mtime.
+	CreateFileExclusive(path string, d []byte, perm os.FileMode, mtime time.Time, sync bool) error
+}
+
+// osFileSystem is the default FileSystem.
+type osFileSystem struct{}
+
+var _ FileSystem = osFileSystem{}
+
+func (osFileSystem) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func (osFileSystem) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (osFileSystem) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (osFileSystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFileSystem) Link(oldpath, newpath string) error {
+	return os.Link(oldpath, newpath)
+}
+
+func (osFileSystem) Chtimes(path string, atime, mtime time.Time) error {
+	return os.Chtimes(path, atime, mtime)
+}
+
+func (osFileSystem) Chmod(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+func (osFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFileSystem) WriteFileAtomic(path string, d []byte, perm os.FileMode, sync bool) error {
+	// atomicfile sets the mode with chmod, which is not subject to the umask.
+	f, err := atomicfile.New(path, perm)
+	if err != nil {
+		return err
+	}
+
+	// If we don't make it to the graceful Close below, throw out anything we managed to get on disk.
+	defer func() {
+		_ = f.Abort()
+	}()
+
+	if _, err := f.Write(d); err != nil {
+		return errors.Wrap(err, "failed to write pid")
+	}
+
+	if sync {
+		if err := f.Sync(); err != nil {
+			return errors.Wrap(err, "failed to sync")
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "failed to close")
+	}
+	return syncParent(path, sync)
+}
+
+// CreateFileExclusive writes the complete file under a temporary name and then hard-links it into place.  Unlike a
+// rename, the link fails if the file already exists, so we never replace a file that someone else has created; and, as
+// with WriteFileAtomic, nobody can observe a partially-written file.
+//
+// Some filesystems, such as vfat and some FUSE and SMB mounts, do not support hard links.  On those, the file is
+// instead created in place with O_EXCL, and a reader may briefly see it empty or partially written.
+func (osFileSystem) CreateFileExclusive(path string, d []byte, perm os.FileMode, mtime time.Time, sync bool) error {
+	return createFileExclusive(path, d, perm, mtime, sync, os.Link)
+}
+
+// createFileExclusive implements osFileSystem.CreateFileExclusive, using link to make hard links.
+func createFileExclusive(path string, d []byte, perm os.FileMode, mtime time.Time, sync bool,
+	link func(oldpath, newpath string) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	// Whether or not we succeed, the temporary name should not outlive this function.
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	if err := f.Chmod(perm); err != nil {
+		return errors.Wrap(err, "failed to set mode")
+	}
+
+	if _, err := f.Write(d); err != nil {
+		return errors.Wrap(err, "failed to write pid")
+	}
+
+	if sync {
+		if err := f.Sync(); err != nil {
+			return errors.Wrap(err, "failed to sync")
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "failed to close")
+	}
+
+	if err := os.Chtimes(f.Name(), mtime, mtime); err != nil {
+		return errors.Wrap(err, "failed to set mtime")
+	}
+
+	if err := link(f.Name(), path); err != nil {
+		if linkUnsupported(err) {
+			return createFileInPlace(path, d, perm, mtime, sync)
+		}
+		return err
+	}
+	return syncParent(path, sync)
+}
+
+// linkUnsupported returns true iff err, which was returned by os.Link, means that the filesystem does not support hard
+// links.
+func linkUnsupported(err error) bool {
+	return errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP)
+}
+
+// createFileInPlace is CreateFileExclusive for filesystems without hard links.  The file is created with O_EXCL, so
+// we still never replace a file that someone else has created, and is removed again if it cannot be written.
+func createFileInPlace(path string, d []byte, perm os.FileMode, mtime time.Time, sync bool) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	written := false
+	defer func() {
+		_ = f.Close()
+		if !written {
+			_ = os.Remove(path)
+		}
+	}()
+
+	// The mode given to OpenFile is subject to the umask.
+	if err := f.Chmod(perm); err != nil {
+		return errors.Wrap(err, "failed to set mode")
+	}
+
+	if _, err := f.Write(d); err != nil {
+		return errors.Wrap(err, "failed to write pid")
+	}
+
+	if sync {
+		if err := f.Sync(); err != nil {
+			return errors.Wrap(err, "failed to sync")
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "failed to close")
+	}
+
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		return errors.Wrap(err, "failed to set mtime")
+	}
+
+	written = true
+	return syncParent(path, sync)
+}
+
+// syncParent flushes the directory containing path, so that path's directory entry survives a crash, if sync is true.
+func syncParent(path string, sync bool) error {
+	if !sync {
+		return nil
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return errors.Wrap(err, "failed to sync parent directory")
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package pidfile
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// faultyFileSystem is a FileSystem that fails the operations named in errs with the corresponding error, and otherwise
+// uses the operating system's filesystem.  Unlike tests that rely on file modes, it works when run as root.
+type faultyFileSystem struct {
+	osFileSystem
+	errs map[string]error
+
+	// The first writeFailures writes fail with writeFailErr, whatever errs says.  writes counts attempted writes.
+	writeFailures int
+	writeFailErr  error
+	writes        int
+
+	// If set, beforeRename is called at the start of each Rename.
+	beforeRename func(oldpath, newpath string)
+	// If set, removeErr is called at the start of each Remove, which fails with the error that it returns, if any.
+	removeErr func(path string) error
+}
+
+// writeErr returns the error with which a write should fail, if any.
+func (fs *faultyFileSystem) writeErr() error {
+	fs.writes++
+	if fs.writeFailures > 0 {
+		fs.writeFailures--
+		return fs.writeFailErr
+	}
+	return fs.errs["write"]
+}
+
+var _ FileSystem = (*faultyFileSystem)(nil)
+
+func (fs *faultyFileSystem) Open(path string) (io.ReadCloser, error) {
+	if err := fs.errs["open"]; err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return fs.osFileSystem.Open(path)
+}
+
+func (fs *faultyFileSystem) Stat(path string) (os.FileInfo, error) {
+	if err := fs.errs["stat"]; err != nil {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+	return fs.osFileSystem.Stat(path)
+}
+
+func (fs *faultyFileSystem) Rename(oldpath, newpath string) error {
+	if fs.beforeRename != nil {
+		fs.beforeRename(oldpath, newpath)
+	}
+	return fs.osFileSystem.Rename(oldpath, newpath)
+}
+
+func (fs *faultyFileSystem) Remove(path string) error {
+	if err := fs.errs["remove"]; err != nil {
+		return &os.PathError{Op: "remove", Path: path, Err: err}
+	}
+	if fs.removeErr != nil {
+		if err := fs.removeErr(path); err != nil {
+			return &os.PathError{Op: "remove", Path: path, Err: err}
+		}
+	}
+	return fs.osFileSystem.Remove(path)
+}
+
+func (fs *faultyFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	if err := fs.errs["mkdir"]; err != nil {
+		return &os.PathError{Op: "mkdir", Path: path, Err: err}
+	}
+	return fs.osFileSystem.MkdirAll(path, perm)
+}
+
+func (fs *faultyFileSystem) WriteFileAtomic(path string, d []byte, perm os.FileMode, sync bool) error {
+	if err := fs.writeErr(); err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return fs.osFileSystem.WriteFileAtomic(path, d, perm, sync)
+}
+
+func (fs *faultyFileSystem) CreateFileExclusive(path string, d []byte, perm os.FileMode, mtime time.Time,
+	sync bool) error {
+	if err := fs.writeErr(); err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return fs.osFileSystem.CreateFileExclusive(path, d, perm, mtime, sync)
+}
+
+// If the FileSystem refuses to write the pidfile, Write and Lock should report an ErrCannotWrite.
+func TestFileSystem_CannotWrite(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	fs := &faultyFileSystem{errs: map[string]error{"write": os.ErrPermission}}
+	pidfile, err := New(pidfilePath, WithFileSystem(fs))
+	assert.Nil(t, err)
+
+	err = pidfile.Write(0)
+	var cwErr *ErrCannotWrite
+	assert.True(t, errors.As(err, &cwErr))
+	assert.True(t, errors.Is(err, os.ErrPermission))
+
+	lock, err := NewLock(pidfilePath, WithFileSystem(fs))
+	assert.Nil(t, err)
+	err = lock.Lock(0)
+	assert.True(t, errors.As(err, &cwErr))
+
+	_, err = os.Stat(pidfilePath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// If the FileSystem refuses to create the pidfile's directory, Write should report an ErrCannotWrite.
+func TestFileSystem_CannotCreateDirs(t *testing.T) {
+	pidfilePath := filepath.Join(tempfilename(t), "pidfile")
+
+	fs := &faultyFileSystem{errs: map[string]error{"mkdir": os.ErrPermission}}
+	pidfile, err := New(pidfilePath, WithFileSystem(fs))
+	assert.Nil(t, err)
+
+	err = pidfile.Write(0)
+	var cwErr *ErrCannotWrite
+	assert.True(t, errors.As(err, &cwErr))
+	assert.True(t, errors.Is(err, os.ErrPermission))
+}
+
+// If the FileSystem refuses to open the pidfile, Read should say so rather than reporting that it does not exist.
+func TestFileSystem_CannotRead(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	fs := &faultyFileSystem{errs: map[string]error{}}
+	pidfile, err := New(pidfilePath, WithFileSystem(fs))
+	assert.Nil(t, err)
+	assert.Nil(t, pidfile.Write(0))
+
+	fs.errs["open"] = os.ErrPermission
+	_, _, err = pidfile.Read()
+	assert.True(t, errors.Is(err, os.ErrPermission), "unexpected error: %v", err)
+	assert.False(t, errors.Is(err, os.ErrNotExist))
+}
+
+// With WithWriteRetry, Write and Lock should retry a write that fails with a retriable error.
+func TestFileSystem_WriteRetry(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	fs := &faultyFileSystem{writeFailures: 2, writeFailErr: syscall.ESTALE}
+	pidfile, err := New(pidfilePath, WithFileSystem(fs), WithWriteRetry(3, time.Millisecond))
+	assert.Nil(t, err)
+	assert.Nil(t, pidfile.Write(1234))
+	assert.Equal(t, 3, fs.writes)
+
+	pid, _, err := pidfile.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1234), pid)
+	assert.Nil(t, os.Remove(pidfilePath))
+
+	// Lock retries in the same way.
+	fs = &faultyFileSystem{writeFailures: 2, writeFailErr: syscall.EAGAIN}
+	lock, err := NewLock(pidfilePath, WithFileSystem(fs), WithWriteRetry(3, time.Millisecond))
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Lock(0))
+	assert.Equal(t, 3, fs.writes)
+	assert.Nil(t, lock.Unlock(0))
+
+	// We give up after the configured number of attempts.
+	fs = &faultyFileSystem{writeFailures: 3, writeFailErr: syscall.ESTALE}
+	pidfile, err = New(pidfilePath, WithFileSystem(fs), WithWriteRetry(3, time.Millisecond))
+	assert.Nil(t, err)
+	err = pidfile.Write(1234)
+	assert.True(t, errors.Is(err, syscall.ESTALE), "unexpected error: %v", err)
+	assert.Equal(t, 3, fs.writes)
+
+	// Errors that are not retriable are not retried, and by default nothing is.
+	fs = &faultyFileSystem{writeFailures: 1, writeFailErr: syscall.EIO}
+	pidfile, err = New(pidfilePath, WithFileSystem(fs), WithWriteRetry(3, time.Millisecond))
+	assert.Nil(t, err)
+	assert.NotNil(t, pidfile.Write(1234))
+	assert.Equal(t, 1, fs.writes)
+
+	fs = &faultyFileSystem{writeFailures: 1, writeFailErr: syscall.ESTALE}
+	pidfile, err = New(pidfilePath, WithFileSystem(fs))
+	assert.Nil(t, err)
+	assert.NotNil(t, pidfile.Write(1234))
+	assert.Equal(t, 1, fs.writes)
+
+	fs = &faultyFileSystem{writeFailures: 1, writeFailErr: syscall.EIO}
+	pidfile, err = New(pidfilePath, WithFileSystem(fs), WithWriteRetry(2, time.Millisecond),
+		WithRetriableErrors(syscall.EIO))
+	assert.Nil(t, err)
+	assert.Nil(t, pidfile.Write(1234))
+	assert.Equal(t, 2, fs.writes)
+}
+
+// ReadPid should not need to stat the pidfile.
+func TestFileSystem_ReadPidWithoutStat(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	fs := &faultyFileSystem{errs: map[string]error{}}
+	pidfile, err := New(pidfilePath, WithFileSystem(fs))
+	assert.Nil(t, err)
+	assert.Nil(t, pidfile.Write(1234))
+
+	fs.errs["stat"] = syscall.EIO
+	_, _, err = pidfile.Read()
+	assert.True(t, errors.Is(err, syscall.EIO), "unexpected error: %v", err)
+
+	pid, err := pidfile.ReadPid()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1234), pid)
+
+	fs.errs["open"] = os.ErrNotExist
+	_, err = pidfile.ReadPid()
+	assert.True(t, errors.Is(err, os.ErrNotExist), "unexpected error: %v", err)
+}
+
+// Unlock should report, rather than ignore, a failure to remove the pidfile; and the lock should still be held.
+func TestFileSystem_CannotRemove(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	fs := &faultyFileSystem{errs: map[string]error{}}
+	lock, err := NewLock(pidfilePath, WithFileSystem(fs))
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Lock(0))
+
+	fs.errs["remove"] = os.ErrPermission
+	err = lock.Unlock(0)
+	assert.True(t, errors.Is(err, os.ErrPermission), "unexpected error: %v", err)
+
+	pid, err := lock.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+
+	delete(fs.errs, "remove")
+	assert.Nil(t, lock.Unlock(0))
+}
+
+// If another process steals the lock after Unlock has checked that we hold it, Unlock should leave the thief's pidfile
+// alone and report that we no longer hold the lock.
+func TestFileSystem_UnlockRacesSteal(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	fs := &faultyFileSystem{errs: map[string]error{}}
+	lock, err := NewLock(pidfilePath, WithFileSystem(fs))
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Lock(0))
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	thief, err := NewLock(pidfilePath)
+	assert.Nil(t, err)
+	fs.beforeRename = func(oldpath, newpath string) {
+		fs.beforeRename = nil
+		assert.Nil(t, thief.Steal(1))
+	}
+
+	err = lock.Unlock(0)
+	var notOwnerErr *ErrNotOwner
+	if assert.True(t, errors.As(err, &notOwnerErr), "unexpected error: %v", err) {
+		assert.Equal(t, Pid(1), notOwnerErr.Holder)
+	}
+
+	pid, err := thief.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1), pid)
+
+	matches, err := filepath.Glob(pidfilePath + ".*")
+	assert.Nil(t, err)
+	assert.Empty(t, matches)
+}
+
+// On a filesystem without hard links, CreateFileExclusive should still create the file and refuse to replace one.
+func TestCreateFileExclusive_NoHardLinks(t *testing.T) {
+	dir := tempfilename(t)
+	assert.Nil(t, os.Mkdir(dir, os.FileMode(0755)))
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	pidfilePath := filepath.Join(dir, "pidfile")
+
+	noLink := func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "link", Old: oldpath, New: newpath, Err: syscall.EPERM}
+	}
+	mtime := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, createFileExclusive(pidfilePath, []byte("1234\n"), os.FileMode(0640), mtime, true, noLink))
+
+	d, err := ioutil.ReadFile(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "1234\n", string(d))
+	st, err := os.Stat(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0640), st.Mode().Perm())
+	assert.True(t, mtime.Equal(st.ModTime()))
+
+	err = createFileExclusive(pidfilePath, []byte("4321\n"), os.FileMode(0640), mtime, false, noLink)
+	assert.True(t, errors.Is(err, os.ErrExist), "unexpected error: %v", err)
+	d, err = ioutil.ReadFile(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "1234\n", string(d))
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{pidfilePath}, matches)
+}
@@ -0,0 +1,82 @@
+package pidfile
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// A ManagedLock is a PidfileLock held by the current process that is released automatically when the process receives
+// one of a set of signals or panics.
+type ManagedLock interface {
+	PidfileLock
+
+	// Recover releases the lock if the goroutine is panicking and then continues panicking.  It must be deferred
+	// directly (e.g. `defer lock.Recover()`), typically at the top of main.
+	Recover()
+	// Stop tears down the signal handler.  It does not release the lock.
+	Stop()
+}
+
+type managedLock struct {
+	PidfileLock
+
+	sigCh    chan os.Signal
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+var _ ManagedLock = (*managedLock)(nil)
+
+// AcquireManaged takes the lock at the given path on behalf of the current process and installs a handler that
+// releases it when any of sigs is received.  Once the lock has been released, the signal is re-raised so that the
+// process's default disposition (or any other handler registered for it) still applies.
+func AcquireManaged(path string, sigs ...os.Signal) (ManagedLock, error) {
+	l, err := NewLock(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.Lock(0); err != nil {
+		return nil, errors.Wrap(err, "failed to acquire lock")
+	}
+
+	m := &managedLock{
+		PidfileLock: l,
+		sigCh:       make(chan os.Signal, 1),
+		stopCh:      make(chan struct{}),
+	}
+	if len(sigs) != 0 {
+		signal.Notify(m.sigCh, sigs...)
+		go m.handleSignals()
+	}
+	return m, nil
+}
+
+func (m *managedLock) handleSignals() {
+	select {
+	case sig := <-m.sigCh:
+		_ = m.Unlock(0)
+		m.Stop()
+		if proc, err := os.FindProcess(os.Getpid()); err == nil {
+			_ = proc.Signal(sig)
+		}
+	case <-m.stopCh:
+	}
+}
+
+func (m *managedLock) Recover() {
+	if r := recover(); r != nil {
+		_ = m.Unlock(0)
+		panic(r)
+	}
+}
+
+func (m *managedLock) Stop() {
+	m.stopOnce.Do(func() {
+		signal.Stop(m.sigCh)
+		close(m.stopCh)
+	})
+}
@@ -0,0 +1,87 @@
+//go:build !windows
+// +build !windows
+
+package pidfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempManagedLockPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "pidfile-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	return filepath.Join(dir, "test.pid"), func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// Receiving one of the registered signals should release the lock.  SIGWINCH is ignored by default, so re-raising it
+// does not disturb the test process.
+func TestAcquireManaged_Signal(t *testing.T) {
+	path, cleanup := tempManagedLockPath(t)
+	defer cleanup()
+
+	l, err := AcquireManaged(path, syscall.SIGWINCH)
+	assert.Nil(t, err)
+	defer l.Stop()
+
+	pid, err := l.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGWINCH))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pidfile was not removed after signal")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// A panic in a function that defers Recover should release the lock and keep panicking.
+func TestAcquireManaged_Panic(t *testing.T) {
+	path, cleanup := tempManagedLockPath(t)
+	defer cleanup()
+
+	l, err := AcquireManaged(path)
+	assert.Nil(t, err)
+	defer l.Stop()
+
+	assert.Panics(t, func() {
+		defer l.Recover()
+		panic("boom")
+	})
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "pidfile exists when it should not")
+}
+
+// Stop should tear down the handler without releasing the lock.
+func TestAcquireManaged_Stop(t *testing.T) {
+	path, cleanup := tempManagedLockPath(t)
+	defer cleanup()
+
+	l, err := AcquireManaged(path, syscall.SIGWINCH)
+	assert.Nil(t, err)
+
+	l.Stop()
+	l.Stop()
+
+	pid, err := l.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+}
@@ -1,136 +1,824 @@
 package pidfile
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/shirou/gopsutil/process"
 )
 
+// isWrappedNotExist returns true iff err indicates that a file does not exist.  The error may have been wrapped with
+// pkg/errors or with fmt.Errorf's %w, and may be os.ErrNotExist itself (which is fs.ErrNotExist) or an error that
+// matches it, such as syscall.ENOENT.
 func isWrappedNotExist(err error) bool {
-	for err != nil {
-		if os.IsNotExist(err) {
-			return true
-		}
-		err = errors.Cause(err)
-	}
-	return false
+	return err != nil && (os.IsNotExist(errors.Cause(err)) || errors.Is(err, os.ErrNotExist))
 }
 
 // A PidfileLock is ... TODO: writeme ...
 // It is considered valid only while the original process runs.
+//
+// A PidfileLock may be used from several goroutines.  Its methods are serialized, so that none of them sees another
+// half done; for example, Lock never takes the lock in the moment between Relocate removing the old pidfile and
+// switching to the new one.  This is only true of calls on the same PidfileLock.  The pidfile, not the PidfileLock, is
+// what excludes other PidfileLocks and other processes.
 type PidfileLock interface {
 	Pidfile
 
 	Holder() (Pid, error)
+	HolderWithContext(context.Context) (Pid, error)
+	HolderInfo() (*HolderInfo, error)
+	HolderProcess() (*process.Process, error)
+	Status() (Status, error)
+	IsStale() (bool, error)
+	Peek() (Pid, time.Time, bool, error)
+	RemoveIfStale() (bool, error)
 	Lock(Pid) error
+	DryRunLock(Pid) (bool, Pid, error)
+	LockWithContext(context.Context, Pid) error
+	WaitForRelease(context.Context) error
+	Acquire(Pid) (func() error, error)
+	LockCloser(Pid) (io.Closer, error)
+	Adopt(Pid) error
 	Unlock(Pid) error
+	UnlockWithContext(context.Context, Pid) error
+	Steal(Pid) error
+	ForceUnlock() error
+	HandOff(Pid) error
+	Swap(oldPid, newPid Pid) error
+	SendSignal(os.Signal) error
+	Touch() error
+	Relocate(string) error
+	DebugInfo() (LockDebugInfo, error)
+	QuickCheck() (bool, error)
+}
+
+// HolderInfo describes the process that holds a lock.
+type HolderInfo struct {
+	Pid Pid `json:"pid"`
+	// CreateTime is the time at which the process was created, or the zero time if the ProcessChecker does not know.
+	CreateTime time.Time `json:"create_time"`
+	// Cmdline is the process's command line, with arguments separated by spaces.  It is empty if the holder is on
+	// another host.
+	Cmdline string `json:"cmdline"`
+	// Hostname is the host recorded in the pidfile (see WithHostname), or empty if none was recorded.
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// LockDebugInfo exposes the values that go into deciding whether a lock is valid.  It is meant for diagnosing validity
+// decisions in the field; see DebugInfo.
+type LockDebugInfo struct {
+	// RecordedPid is the pid read from the pidfile.
+	RecordedPid Pid
+	// RecordedHostname is the hostname read from the pidfile, or empty if none was recorded.
+	RecordedHostname string
+	// RecordedBootID is the boot ID read from the pidfile, or empty if none was recorded.
+	RecordedBootID string
+	// Foreign is true iff the pidfile was written on another host.  Such a lock is always considered held, and none of
+	// the process fields below are filled in.
+	Foreign bool
+	// FileMtime is the modification time of the pidfile.
+	FileMtime time.Time
+	// Expired is true iff the pidfile's mtime is older than the lock's TTL (see WithLockTTL).  Such a lock is never
+	// considered held, and none of the process fields below are filled in.
+	Expired bool
+	// ProcCreateRawMs is the creation time of the recorded process as reported by the ProcessChecker, in milliseconds
+	// since the epoch.  It is zero if the process does not exist, could not be inspected, or the checker does not know
+	// when it was created.
+	ProcCreateRawMs int64
+	// ProcCreateTime is ProcCreateRawMs as used in the comparison against FileMtime, which is made at millisecond
+	// precision.
+	ProcCreateTime time.Time
+	// Valid is true iff the lock is considered held.
+	Valid bool
 }
 
 type pidfileLock struct {
 	*pidfile
+
+	checker ProcessChecker
+
+	// useFlock is true iff the lock is held by means of an advisory lock on the pidfile; see NewFlockLock.
+	useFlock bool
+	// mu serializes the lock's methods, so that they behave consistently when called from several goroutines; it also
+	// protects flockFile and the path of the pidfile, which Relocate changes.
+	mu sync.Mutex
+	// flockFile is the open pidfile on which we hold an advisory lock, if we hold the lock.
+	flockFile *os.File
 }
 
 var _ PidfileLock = (*pidfileLock)(nil)
 
-func NewLock(path string) (PidfileLock, error) {
-	p, err := New(path)
+// NewLock returns a PidfileLock that uses the pidfile at the given path.  The options apply both to the pidfile itself
+// (as with New) and to the lock.
+func NewLock(path string, opts ...Option) (PidfileLock, error) {
+	p, err := New(path, opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	pf := p.(*pidfile)
 	return &pidfileLock{
-		pidfile: p.(*pidfile),
+		pidfile: pf,
+		checker: pf.opts.checker,
 	}, nil
 }
 
-// // If err != nil, returns zero-values for pid and ts.
-// func (p *pidfileLock) read() (Pid, time.Time, error) {
-// 	return Pid(0), time.Time{}, errors.New("not implemented")
-// }
+// The methods of Pidfile are wrapped so that they are serialized with the lock's other methods; in particular, so that
+// they do not race with Relocate.
+
+func (p *pidfileLock) Path() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pidfile.Path()
+}
+
+func (p *pidfileLock) Dir() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pidfile.Dir()
+}
+
+func (p *pidfileLock) Write(pid Pid) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pidfile.Write(pid)
+}
+
+func (p *pidfileLock) Read() (Pid, time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pidfile.Read()
+}
+
+func (p *pidfileLock) ReadPid() (Pid, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pidfile.ReadPid()
+}
+
+func (p *pidfileLock) ReadMeta() (Pid, Meta, time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pidfile.ReadMeta()
+}
+
+func (p *pidfileLock) ReadWithInfo() (Pid, ReadInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pidfile.ReadWithInfo()
+}
+
+func (p *pidfileLock) Stat() (os.FileInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pidfile.Stat()
+}
 
-// Returns true iff a lock created by the given pid at the given time is still valid; that is, if the same process was
-// running when the lock was created.  If the process does not exist, (false, nil) is returned.
-func (p *pidfileLock) lockValid(pid Pid, mtime time.Time) (bool, error) {
-	info, err := process.NewProcess(int32(pid))
+func (p *pidfileLock) Exists() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pidfile.Exists()
+}
+
+// Returns true iff a lock recorded at the given time is still valid; that is, if the process that it names was running
+// when the lock was created.  If the process does not exist, (false, nil) is returned.  A lock recorded on another host
+// cannot be checked, and is always considered valid.
+func (p *pidfileLock) lockValid(ctx context.Context, rec record, mtime time.Time) (bool, error) {
+	info, err := p.inspectLock(ctx, rec, mtime)
+	return info.Valid, err
+}
+
+// inspectLock does the work behind lockValid, returning the intermediate values that the verdict is based on.
+func (p *pidfileLock) inspectLock(ctx context.Context, rec record, mtime time.Time) (LockDebugInfo, error) {
+	info, err := p.decideLock(ctx, rec, mtime)
 	if err != nil {
-		if os.IsNotExist(err) {
-			err = nil
+		return info, err
+	}
+
+	fields := map[string]interface{}{
+		"pid":   info.RecordedPid,
+		"mtime": info.FileMtime,
+	}
+	if !info.ProcCreateTime.IsZero() {
+		fields["create_time"] = info.ProcCreateTime
+	}
+	if info.RecordedHostname != "" {
+		fields["hostname"] = info.RecordedHostname
+	}
+	if info.Valid {
+		p.log("lock.holder_alive", fields)
+	} else {
+		p.log("lock.stale", fields)
+	}
+	return info, nil
+}
+
+// decideLock decides whether a lock is valid on behalf of inspectLock.
+func (p *pidfileLock) decideLock(ctx context.Context, rec record, mtime time.Time) (LockDebugInfo, error) {
+	info := LockDebugInfo{
+		RecordedPid:      rec.pid,
+		RecordedHostname: rec.hostname,
+		RecordedBootID:   rec.bootID,
+		FileMtime:        mtime,
+	}
+
+	if p.useFlock {
+		held, err := flockHeld(p.path)
+		info.Valid = held
+		return info, err
+	}
+
+	if rec.pid == Pid(0) {
+		// The pidfile is empty.
+		return info, nil
+	}
+
+	if p.opts.lockTTL > 0 && p.opts.clock.Now().Sub(mtime) > p.opts.lockTTL {
+		// The lease has expired, whatever has become of its holder.
+		info.Expired = true
+		return info, nil
+	}
+
+	local, err := isLocal(rec)
+	if err != nil {
+		return info, err
+	}
+	if !local {
+		// The pid belongs to a process on another host; any local process with the same pid is unrelated to it.
+		info.Foreign = true
+		info.Valid = true
+		return info, nil
+	}
+
+	if rec.bootID != "" {
+		if id := readBootID(); id != "" && id != rec.bootID {
+			// The lock was taken before the system was last rebooted.
+			return info, nil
 		}
-		return false, errors.Wrap(err, "failed to get process information")
 	}
 
-	// XXX: The docs for this function say that it returns seconds, but it clearly returns milliseconds.
-	procCreateUnixMs, err := info.CreateTime()
+	procCreateTime, exists, err := p.checker.CreateTime(ctx, rec.pid)
 	if err != nil {
-		if os.IsNotExist(err) {
-			err = nil
+		if p.opts.lockTTL > 0 {
+			// We cannot see the holder, but its lease has not expired.
+			info.Valid = true
+			return info, nil
 		}
-		return false, errors.Wrap(err, "failed to get process creation time")
+		return info, err
+	}
+	if !exists {
+		return info, nil
+	}
+
+	if procCreateTime.IsZero() {
+		// The checker cannot tell us when the process was created, so all we know is that it is running.
+		info.Valid = true
+		return info, nil
+	}
+
+	// Process creation times are only reported with millisecond precision, so compare the pidfile's mtime at the same
+	// precision; otherwise a process created later in the same millisecond would look like it predates the pidfile.
+	info.ProcCreateRawMs = procCreateTime.UnixNano() / int64(time.Millisecond)
+	info.ProcCreateTime = time.Unix(0, info.ProcCreateRawMs*int64(time.Millisecond))
+	info.Valid = info.ProcCreateTime.Before(mtime.Truncate(time.Millisecond).Add(p.opts.validityGrace))
+	return info, nil
+}
+
+// log reports an event to the configured logger, if any; see WithLogger.
+func (p *pidfileLock) log(event string, fields map[string]interface{}) {
+	if p.opts.logger == nil {
+		return
+	}
+	fields["path"] = p.path
+	p.opts.logger(event, fields)
+}
+
+// isLocal returns true iff rec was written on this host, or does not say where it was written.
+func isLocal(rec record) (bool, error) {
+	if rec.hostname == "" {
+		return true, nil
 	}
 
-	procCreateTime := time.Unix(procCreateUnixMs/1000, 0)
-	return procCreateTime.Before(mtime), nil
+	hostname, err := os.Hostname()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get hostname")
+	}
+	return rec.hostname == hostname, nil
+}
+
+// writeLock writes the pidfile and sets its mtime, which marks the time at which the lock was taken, from the lock's
+// clock.
+func (p *pidfileLock) writeLock(pid Pid) error {
+	if err := p.pidfile.Write(pid); err != nil {
+		return err
+	}
+
+	now := p.opts.clock.Now()
+	if err := retryEINTR(func() error {
+		return p.opts.fs.Chtimes(p.path, now, now)
+	}); err != nil {
+		return errors.Wrapf(err, "failed to set mtime of pidfile: %v", p.path)
+	}
+	return nil
 }
 
 // Holder returns the pid of the process that holds the lock, or 0 if none exists.  The lock is only considered held if
 // the pidfile exists, the process whose pid matches its contents is running, and that process started before the mtime
-// of the pidfile.
+// of the pidfile.  If the pidfile was written on another host (see WithHostname), the pid is that of a process on that
+// host.
 func (p *pidfileLock) Holder() (Pid, error) {
-	lockPid, lockMtime, err := p.pidfile.Read()
+	return p.HolderWithContext(context.Background())
+}
+
+// HolderWithContext is like Holder, but gives up inspecting the holder's process, returning ctx.Err(), once ctx is
+// done.  This bounds the time spent on a ProcessChecker that has wedged, for example on an unresponsive procfs.
+func (p *pidfileLock) HolderWithContext(ctx context.Context) (Pid, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rec, err := p.holder(ctx)
+	if err != nil && ctx.Err() != nil {
+		return Pid(0), ctx.Err()
+	}
+	return rec.pid, err
+}
+
+// readLock is like read, but reads an empty pidfile, which was presumably left behind by a writer that crashed, as a
+// record with no pid rather than failing.  Such a record never represents a valid lock.
+func (p *pidfileLock) readLock() (record, time.Time, error) {
+	rec, mtime, err := p.read()
+	if errors.Is(err, ErrEmptyPidfile) {
+		st, err := p.pidfile.Stat()
+		if err != nil {
+			return record{}, time.Time{}, err
+		}
+		return record{}, st.ModTime(), nil
+	}
+	return rec, mtime, err
+}
+
+// holder is like Holder, but returns everything recorded about the holder, or a zero record if there is none.
+func (p *pidfileLock) holder(ctx context.Context) (record, error) {
+	rec, lockMtime, err := p.readLock()
 	if err != nil {
 		if isWrappedNotExist(err) {
-			return Pid(0), nil
+			return record{}, nil
 		}
-		return Pid(0), errors.Wrap(err, "failed to read pidfile")
+		return record{}, errors.Wrap(err, "failed to read pidfile")
 	}
 
-	ok, err := p.lockValid(lockPid, lockMtime)
+	ok, err := p.lockValid(ctx, rec, lockMtime)
 	if err != nil {
-		return Pid(0), errors.Wrap(err, "failed to validate lock")
+		return record{}, errors.Wrap(err, "failed to validate lock")
 	}
 
 	if !ok {
-		return Pid(0), nil
+		return record{}, nil
+	}
+	return rec, nil
+}
+
+// HolderInfo is like Holder, but describes the process that holds the lock in more detail.  If no process holds the
+// lock, it returns (nil, nil).
+func (p *pidfileLock) HolderInfo() (*HolderInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rec, lockMtime, err := p.readLock()
+	if err != nil {
+		if isWrappedNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read pidfile")
+	}
+
+	info, err := p.inspectLock(context.Background(), rec, lockMtime)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to validate lock")
+	}
+	if !info.Valid {
+		return nil, nil
+	}
+	return p.describeHolder(context.Background(), rec, info)
+}
+
+// describeHolder returns a HolderInfo for the holder of a valid lock, given what inspectLock found out about it.
+func (p *pidfileLock) describeHolder(ctx context.Context, rec record, info LockDebugInfo) (*HolderInfo, error) {
+	holder := &HolderInfo{
+		Pid:        rec.pid,
+		CreateTime: info.ProcCreateTime,
+		Hostname:   rec.hostname,
+	}
+	if info.Foreign {
+		return holder, nil
+	}
+
+	var err error
+	holder.Cmdline, err = p.checker.Cmdline(ctx, rec.pid)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe lock holder")
+	}
+	return holder, nil
+}
+
+// HolderProcess is like Holder, but returns a gopsutil handle on the process that holds the lock, which can be used to
+// inspect it further.  If no process holds the lock, it returns (nil, nil).  A holder on another host (see
+// WithHostname) cannot be inspected, and an error is returned instead.
+func (p *pidfileLock) HolderProcess() (*process.Process, error) {
+	p.mu.Lock()
+	rec, err := p.holder(context.Background())
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if rec.pid == Pid(0) {
+		return nil, nil
+	}
+
+	local, err := isLocal(rec)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to examine existing lock")
+	}
+	if !local {
+		return nil, errors.Errorf("pidfile is held by %d on %s; cannot inspect a process on another host",
+			rec.pid, rec.hostname)
+	}
+
+	proc, err := process.NewProcess(int32(rec.pid))
+	if err != nil {
+		if isProcessNotRunning(err) {
+			// The holder exited after we checked.
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to get process information")
+	}
+	return proc, nil
+}
+
+// IsStale returns true iff the pidfile exists but does not represent a valid lock, because the process it names is no
+// longer running or its pid has been reused.  Unlike Holder, which returns 0 in both cases, it distinguishes a stale
+// pidfile from a missing one, for which it returns false.
+func (p *pidfileLock) IsStale() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rec, lockMtime, err := p.readLock()
+	if err != nil {
+		if isWrappedNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to read pidfile")
+	}
+
+	ok, err := p.lockValid(context.Background(), rec, lockMtime)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to validate lock")
 	}
-	return lockPid, nil
+	return !ok, nil
 }
 
+// maxLockAttempts bounds the number of times that Lock will clear away a stale pidfile and try again.
+const maxLockAttempts = 10
+
 // Lock atomically creates the pidfile and writes the given pid to it.  If any process currently holds the lock, Lock
-// will return an error.  If pid is 0, the pid of the current process is used.
+// will return an *ErrLockHeld identifying it.  If pid is SelfPid, the pid of the current process is used.
+//
+// Lock checks the holder and writes the pidfile as one operation: it creates the pidfile if there is none, replaces it
+// if it does not represent a valid lock, and fails if it records a live holder.  There is no window in which another
+// process can take the lock in between the check and the write; Lock never replaces a pidfile that another process
+// writes while Lock is running, even if it began by examining a stale one.
 func (p *pidfileLock) Lock(pid Pid) error {
-	// XXX: What about the case where the file does exist but the lock is not valid?
-	// TODO: Is it worth special handling of an operation that fails because the lock is already held?
+	return p.lock(context.Background(), pid)
+}
 
-	if pid == 0 {
+// lock implements Lock and LockWithContext.  ctx bounds the time spent inspecting any existing holder.
+func (p *pidfileLock) lock(ctx context.Context, pid Pid) error {
+	if pid == SelfPid {
 		pid = Pid(os.Getpid())
 	}
+	if err := checkWritePid(pid); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	lockPid, err := p.Holder()
+	if p.useFlock {
+		return p.lockFlock(pid)
+	}
+
+	mode := p.opts.fileMode
+	for i := 0; i < maxLockAttempts; i++ {
+		now := p.opts.clock.Now()
+		err := p.create(pid, now, mode)
+		if err == nil {
+			p.log("lock.acquired", map[string]interface{}{"pid": pid, "mtime": now})
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return errors.Wrap(err, "failed to write pidfile")
+		}
+
+		// There is a pidfile in our way.  If it is a valid lock, we are done; otherwise, clear it away and try again.
+		stale, err := p.removeStale(ctx)
+		if err != nil {
+			return err
+		}
+		if stale != nil && p.opts.preserveMode {
+			mode = stale.Mode().Perm()
+		}
+	}
+
+	return errors.Errorf("failed to acquire lock after %d attempts", maxLockAttempts)
+}
+
+// DryRunLock reports whether Lock(pid) would acquire the lock, without writing or removing anything.  If it would not,
+// currentHolder is the pid of the process that holds the lock.  It makes the same checks as Holder, so, like Lock, it
+// reports that a lock held by pid itself cannot be acquired; and the answer may be out of date as soon as it returns.
+func (p *pidfileLock) DryRunLock(pid Pid) (wouldAcquire bool, currentHolder Pid, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rec, err := p.holder(context.Background())
 	if err != nil {
-		return errors.Wrap(err, "failed to examine existing lock")
+		return false, 0, err
+	}
+	return rec.pid == Pid(0), rec.pid, nil
+}
+
+// removeStale removes the pidfile if it does not represent a valid lock, returning its FileInfo if it did so and nil
+// otherwise.  If the pidfile does represent a valid lock, an *ErrLockHeld is returned instead.  The pidfile is only
+// removed if it is the same file that was examined; if another process replaces it in the meantime, the replacement is
+// left in place.
+func (p *pidfileLock) removeStale(ctx context.Context) (os.FileInfo, error) {
+	before, err := stat(p.opts.fs, p.path)
+	if err != nil {
+		if isWrappedNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to stat pidfile")
 	}
-	if lockPid != Pid(0) {
-		return os.ErrExist
+
+	rec, lockMtime, err := p.readLock()
+	if err != nil {
+		if isWrappedNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read pidfile")
 	}
 
-	if err := p.Write(pid); err != nil {
-		return errors.Wrap(err, "failed to write pidfile")
+	ok, err := p.lockValid(ctx, rec, lockMtime)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to validate lock")
+	}
+	if ok {
+		return nil, &ErrLockHeld{Pid: rec.pid, Hostname: rec.hostname}
+	}
+
+	// Move the pidfile aside before removing it so that we can make sure that it is the file we examined.
+	stalePath := fmt.Sprintf("%s.stale-%d-%d", p.path, os.Getpid(), time.Now().UnixNano())
+	if err := retryEINTR(func() error {
+		return p.opts.fs.Rename(p.path, stalePath)
+	}); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to move stale pidfile aside")
+	}
+
+	removed := before
+	if after, err := stat(p.opts.fs, stalePath); err == nil && !sameFile(before, after) {
+		// Someone replaced the pidfile after we examined it; put theirs back.
+		_ = p.opts.fs.Link(stalePath, p.path)
+		removed = nil
+	}
+
+	if err := remove(p.opts.fs, stalePath); err != nil {
+		return nil, errors.Wrap(err, "failed to remove stale pidfile")
+	}
+	if removed != nil {
+		p.log("lock.stale_removed", map[string]interface{}{"pid": rec.pid, "mtime": lockMtime})
+	}
+	return removed, nil
+}
+
+// Peek returns the pid and mtime recorded on disk, whether or not they represent a valid lock, along with whether they
+// do.  If the pidfile does not exist, it returns (0, time.Time{}, false, nil).
+func (p *pidfileLock) Peek() (pid Pid, mtime time.Time, valid bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rec, lockMtime, err := p.readLock()
+	if err != nil {
+		if isWrappedNotExist(err) {
+			return Pid(0), time.Time{}, false, nil
+		}
+		return Pid(0), time.Time{}, false, errors.Wrap(err, "failed to read pidfile")
+	}
+
+	ok, err := p.lockValid(context.Background(), rec, lockMtime)
+	if err != nil {
+		return Pid(0), time.Time{}, false, errors.Wrap(err, "failed to validate lock")
+	}
+	return rec.pid, lockMtime, ok, nil
+}
+
+// RemoveIfStale removes the pidfile if it exists but does not represent a valid lock (see IsStale), returning true iff
+// it did so.  It never removes the pidfile of a running holder.
+func (p *pidfileLock) RemoveIfStale() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	removed, err := p.removeStale(context.Background())
+	var heldErr *ErrLockHeld
+	if errors.As(err, &heldErr) {
+		return false, nil
 	}
+	return removed != nil, err
+}
+
+// sameFile returns true iff a and b describe the same, unmodified file.
+func sameFile(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+// LockWithContext is like Lock, but if another process holds the lock it waits for the lock to be released, checking
+// again at the configured poll interval (see WithPollInterval), until it can take the lock or ctx is done.  If ctx ends
+// first, ctx.Err() is returned.  As with HolderWithContext, ctx also bounds the time spent inspecting the holder.
+func (p *pidfileLock) LockWithContext(ctx context.Context, pid Pid) error {
+	ticker := time.NewTicker(p.opts.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := p.lock(ctx, pid)
+		var heldErr *ErrLockHeld
+		if !errors.As(err, &heldErr) {
+			if err != nil && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForRelease waits until no process holds the lock, checking again at the configured poll interval (see
+// WithPollInterval).  Unlike LockWithContext, it never takes the lock itself.  It returns nil once the lock is
+// released, or ctx.Err() if ctx ends first.
+func (p *pidfileLock) WaitForRelease(ctx context.Context) error {
+	ticker := time.NewTicker(p.opts.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		pid, err := p.HolderWithContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if pid == Pid(0) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Acquire takes the lock like Lock and returns a function that releases it, which makes it easy to defer the release:
+//
+//	release, err := l.Acquire(0)
+//	if err != nil {
+//		return err
+//	}
+//	defer release()
+//
+// The release function calls Unlock with the same pid and returns its error.  Only the first call does anything; later
+// calls return nil.  If pid is SelfPid, the pid of the current process is used.
+func (p *pidfileLock) Acquire(pid Pid) (func() error, error) {
+	if pid == SelfPid {
+		pid = Pid(os.Getpid())
+	}
+
+	if err := p.Lock(pid); err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() error {
+		var err error
+		once.Do(func() {
+			err = p.Unlock(pid)
+		})
+		return err
+	}, nil
+}
+
+// LockCloser is like Acquire, but returns an io.Closer whose Close method releases the lock, for use with code that
+// keeps track of resources to close, such as at shutdown.  As with the function returned by Acquire, only the first
+// call to Close does anything; it returns the error from Unlock, and later calls return nil.
+func (p *pidfileLock) LockCloser(pid Pid) (io.Closer, error) {
+	release, err := p.Acquire(pid)
+	if err != nil {
+		return nil, err
+	}
+	return closerFunc(release), nil
+}
+
+// closerFunc is an io.Closer that calls the function.
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// Adopt takes over a lock that some other program, such as a wrapper script, took on behalf of the process with the
+// given pid by writing its pid to the pidfile.  Unlike Lock, it does not rewrite the pidfile, so the pidfile's mtime,
+// against which the lock's validity is judged, is preserved.  If pid is SelfPid, the pid of the current process is
+// used.
+//
+// Adopt fails with os.ErrNotExist if there is no pidfile, with an *ErrNotOwner if the pidfile records some other
+// process, and with an error if the pidfile records pid but is not a valid lock (because it was written before the
+// process was created, for example).  Locks created with NewFlockLock cannot be adopted.
+func (p *pidfileLock) Adopt(pid Pid) error {
+	if pid == SelfPid {
+		pid = Pid(os.Getpid())
+	}
+	if p.useFlock {
+		return errFlockNotSupported
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
+	rec, lockMtime, err := p.readLock()
+	if err != nil {
+		if isWrappedNotExist(err) {
+			return os.ErrNotExist
+		}
+		return errors.Wrap(err, "failed to read pidfile")
+	}
+
+	if err := checkOwner(rec, pid, "adopted"); err != nil {
+		return err
+	}
+
+	ok, err := p.lockValid(context.Background(), rec, lockMtime)
+	if err != nil {
+		return errors.Wrap(err, "failed to validate lock")
+	}
+	if !ok {
+		return errors.Errorf("pidfile records %d but is not a valid lock; it cannot be adopted", pid)
+	}
+
+	p.log("lock.adopted", map[string]interface{}{"pid": pid, "mtime": lockMtime})
 	return nil
 }
 
-// Unlock releases the lock.  If the lock is not held by a process with the given pid, Unlock will return an error.  If
-// pid is 0, the pid of the current process is used.
+// Unlock releases the lock.  If no process holds the lock, os.ErrNotExist is returned; if the lock is held by a process
+// other than the one on this host with the given pid, the error is an *ErrNotOwner.  If pid is SelfPid, the pid of the
+// current process is used.
 func (p *pidfileLock) Unlock(pid Pid) error {
-	if pid == 0 {
+	return p.UnlockWithContext(context.Background(), pid)
+}
+
+// UnlockWithContext is like Unlock, but gives up inspecting the holder's process, returning ctx.Err(), once ctx is
+// done.
+func (p *pidfileLock) UnlockWithContext(ctx context.Context, pid Pid) error {
+	if pid == SelfPid {
 		pid = Pid(os.Getpid())
 	}
 
-	lockPid, lockMtime, err := p.Read()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.useFlock {
+		return p.unlockFlock(pid)
+	}
+
+	rec, lockMtime, err := p.readLock()
 	if err != nil {
 		if isWrappedNotExist(err) {
 			return os.ErrNotExist
@@ -138,22 +826,293 @@ func (p *pidfileLock) Unlock(pid Pid) error {
 		return errors.Wrap(err, "failed to read pid")
 	}
 
-	ok, err := p.lockValid(lockPid, lockMtime)
+	info, err := p.inspectLock(ctx, rec, lockMtime)
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return errors.Wrap(err, "failed to validate lock")
 	}
 
-	if !ok {
+	if !info.Valid {
 		return os.ErrNotExist
 	}
 
-	if lockPid != pid {
-		return fmt.Errorf("pidfile is held by %d; lock cannot be released by %d", lockPid, pid)
+	if info.Foreign {
+		return &ErrNotOwner{Holder: rec.pid, Hostname: rec.hostname, Caller: pid, Op: "released"}
+	}
+	if rec.pid != pid {
+		return &ErrNotOwner{Holder: rec.pid, Caller: pid, Op: "released"}
+	}
+
+	if err := p.removeOwned(pid); err != nil {
+		return err
+	}
+
+	p.log("lock.released", map[string]interface{}{"pid": pid})
+	return nil
+}
+
+// removeOwned removes the pidfile on behalf of Unlock, but only if it still records pid.  Another process may have
+// replaced the pidfile (with Steal, for example) since Unlock examined it, so we move the pidfile aside, where nobody
+// else will touch it, before looking at it again.  If it no longer records pid, it is put back and an *ErrNotOwner is
+// returned.
+func (p *pidfileLock) removeOwned(pid Pid) error {
+	asidePath := fmt.Sprintf("%s.unlock-%d-%d", p.path, os.Getpid(), time.Now().UnixNano())
+	if err := retryEINTR(func() error {
+		return p.opts.fs.Rename(p.path, asidePath)
+	}); err != nil {
+		if os.IsNotExist(err) {
+			return os.ErrNotExist
+		}
+		return errors.Wrap(err, "failed to move pidfile aside")
+	}
+
+	// putBack restores the pidfile.  If yet another process has created a new pidfile in the meantime, that one is
+	// left in place.
+	putBack := func() {
+		_ = p.opts.fs.Link(asidePath, p.path)
+		_ = remove(p.opts.fs, asidePath)
+	}
+
+	d, err := readFile(p.opts.fs, asidePath)
+	if err != nil {
+		putBack()
+		return errors.Wrap(err, "failed to read pidfile")
+	}
+	rec, err := p.decode(d)
+	if err != nil || rec.pid != pid {
+		putBack()
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse pid from pidfile: %v", p.path)
+		}
+		return &ErrNotOwner{Holder: rec.pid, Caller: pid, Op: "released"}
+	}
+
+	if err := remove(p.opts.fs, asidePath); err != nil {
+		_ = p.opts.fs.Rename(asidePath, p.path)
+		return errors.Wrap(err, "failed to remove pidfile")
+	}
+	return nil
+}
+
+// Steal replaces the pidfile so that it records the given pid, regardless of which process (if any) currently holds the
+// lock.  If pid is SelfPid, the pid of the current process is used.
+//
+// Steal bypasses the validity check and can leave two processes believing that they hold the lock.  It is intended for
+// administrative recovery, such as when the holder is wedged and is about to be killed.
+func (p *pidfileLock) Steal(pid Pid) error {
+	if pid == SelfPid {
+		pid = Pid(os.Getpid())
+	}
+	if p.useFlock {
+		return errFlockNotSupported
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.writeLock(pid); err != nil {
+		return errors.Wrap(err, "failed to write pidfile")
+	}
+	return nil
+}
+
+// ForceUnlock removes the pidfile, regardless of which process (if any) currently holds the lock.  If the pidfile does
+// not exist, os.ErrNotExist is returned.
+//
+// Like Steal, ForceUnlock bypasses the validity check and is intended for administrative recovery.
+func (p *pidfileLock) ForceUnlock() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.useFlock {
+		defer p.releaseFlock()
 	}
 
-	if err := os.Remove(p.path); err != nil {
+	if err := remove(p.opts.fs, p.path); err != nil {
+		if os.IsNotExist(err) {
+			return os.ErrNotExist
+		}
 		return errors.Wrap(err, "failed to remove pidfile")
 	}
+	return nil
+}
+
+// HandOff transfers the lock from the current process to the process with the given pid by rewriting the pidfile, so
+// that Holder immediately reports the successor.  The current process must hold the lock: if no process does,
+// os.ErrNotExist is returned, and if another process does, the error is an *ErrNotOwner.  The successor must already
+// be running on this host; otherwise the rewritten pidfile will not be considered a valid lock.
+func (p *pidfileLock) HandOff(to Pid) error {
+	if to == 0 {
+		return errors.New("cannot hand off lock to pid 0")
+	}
+	return p.swap(Pid(os.Getpid()), to, "handed off")
+}
+
+// Swap is like HandOff, but transfers the lock from oldPid, which must hold it, rather than from the current process.
+// The pidfile is rewritten atomically, so there is no moment at which the lock appears to be free; this suits a daemon
+// that re-executes itself to upgrade, where either the old or the new process may make the call.  If oldPid or newPid
+// is SelfPid, the pid of the current process is used.
+func (p *pidfileLock) Swap(oldPid, newPid Pid) error {
+	if oldPid == SelfPid {
+		oldPid = Pid(os.Getpid())
+	}
+	if newPid == SelfPid {
+		newPid = Pid(os.Getpid())
+	}
+	return p.swap(oldPid, newPid, "swapped")
+}
+
+// swap implements HandOff and Swap.  op describes the operation in the *ErrNotOwner returned if from does not hold the
+// lock.
+func (p *pidfileLock) swap(from, to Pid, op string) error {
+	if p.useFlock {
+		return errFlockNotSupported
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.requireHolder(from, op); err != nil {
+		return err
+	}
+
+	if err := p.writeLock(to); err != nil {
+		return errors.Wrap(err, "failed to write pidfile")
+	}
 
+	p.log("lock.handed_off", map[string]interface{}{"pid": from, "to": to})
 	return nil
 }
+
+// requireHolder returns the record of the lock's holder, which must be the process on this host with the given pid, or
+// any process on this host if pid is zero.  If no process holds the lock, os.ErrNotExist is returned; otherwise, see
+// checkOwner.  p.mu must be held.
+func (p *pidfileLock) requireHolder(pid Pid, op string) (record, error) {
+	rec, err := p.holder(context.Background())
+	if err != nil {
+		return record{}, errors.Wrap(err, "failed to examine existing lock")
+	}
+	if rec.pid == Pid(0) {
+		return record{}, os.ErrNotExist
+	}
+	if err := checkOwner(rec, pid, op); err != nil {
+		return record{}, err
+	}
+	return rec, nil
+}
+
+// checkOwner returns an *ErrNotOwner, whose Op is op, unless rec was written on this host by the process with the
+// given pid, or by any process on this host if pid is zero.
+func checkOwner(rec record, pid Pid, op string) error {
+	local, err := isLocal(rec)
+	if err != nil {
+		return errors.Wrap(err, "failed to examine existing lock")
+	}
+	if !local {
+		return &ErrNotOwner{Holder: rec.pid, Hostname: rec.hostname, Caller: pid, Op: op}
+	}
+	if pid != 0 && rec.pid != pid {
+		return &ErrNotOwner{Holder: rec.pid, Caller: pid, Op: op}
+	}
+	return nil
+}
+
+// SendSignal sends sig to the process that holds the lock.  If no process holds the lock, including when the pidfile is
+// stale, os.ErrNotExist is returned; a stale pidfile's pid may have been reused by an unrelated process, so it is never
+// signalled.  A holder on another host (see WithHostname) cannot be signalled either; the error is then an
+// *ErrNotOwner.
+func (p *pidfileLock) SendSignal(sig os.Signal) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rec, err := p.requireHolder(0, "signalled")
+	if err != nil {
+		return err
+	}
+
+	proc, err := os.FindProcess(int(rec.pid))
+	if err != nil {
+		return errors.Wrapf(err, "failed to find process %d", rec.pid)
+	}
+	if err := proc.Signal(sig); err != nil {
+		return errors.Wrapf(err, "failed to signal process %d", rec.pid)
+	}
+	return nil
+}
+
+// Touch updates the pidfile's mtime to the current time without changing its contents, so that monitoring can tell that
+// the holder is still making progress.  The current process must hold the lock: if no process does, os.ErrNotExist is
+// returned, and if another process does, the error is an *ErrNotOwner.
+func (p *pidfileLock) Touch() error {
+	pid := Pid(os.Getpid())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.requireHolder(pid, "touched"); err != nil {
+		return err
+	}
+
+	now := p.opts.clock.Now()
+	if err := retryEINTR(func() error {
+		return p.opts.fs.Chtimes(p.path, now, now)
+	}); err != nil {
+		return errors.Wrapf(err, "failed to set mtime of pidfile: %v", p.path)
+	}
+	return nil
+}
+
+// Relocate moves the lock, which the current process must hold, to a pidfile at newPath; from then on, the PidfileLock
+// uses newPath.  The new pidfile is created before the old one is removed, so the lock can always be found at one path
+// or the other.  If a pidfile already exists at newPath, the error satisfies errors.Is(err, os.ErrExist).  If the old
+// pidfile cannot be removed, the new one is removed again and the lock stays where it was.
+func (p *pidfileLock) Relocate(newPath string) error {
+	if p.useFlock {
+		return errFlockNotSupported
+	}
+	pid := Pid(os.Getpid())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.requireHolder(pid, "relocated"); err != nil {
+		return err
+	}
+
+	np := &pidfile{path: newPath, opts: p.opts}
+	if err := np.create(pid, p.opts.clock.Now(), p.opts.fileMode); err != nil {
+		return errors.Wrap(err, "failed to create relocated pidfile")
+	}
+	if err := remove(p.opts.fs, p.path); err != nil {
+		// Leave the lock where it was, rather than with a pidfile at each path.
+		_ = remove(p.opts.fs, newPath)
+		return errors.Wrap(err, "failed to remove old pidfile")
+	}
+
+	p.log("lock.relocated", map[string]interface{}{"pid": pid, "to": newPath})
+	p.path = newPath
+	return nil
+}
+
+// DebugInfo reads the pidfile and returns the intermediate values used to decide whether the lock is valid, along with
+// the verdict.  If the pidfile does not exist, os.ErrNotExist is returned.
+func (p *pidfileLock) DebugInfo() (LockDebugInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rec, lockMtime, err := p.readLock()
+	if err != nil {
+		if isWrappedNotExist(err) {
+			return LockDebugInfo{}, os.ErrNotExist
+		}
+		return LockDebugInfo{}, errors.Wrap(err, "failed to read pid")
+	}
+
+	info, err := p.inspectLock(context.Background(), rec, lockMtime)
+	if err != nil {
+		return info, errors.Wrap(err, "failed to validate lock")
+	}
+	return info, nil
+}
@@ -1,10 +1,16 @@
 package pidfile
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -13,14 +19,48 @@ import (
 )
 
 // TODO: test what happens when:
-//  - we don't have permission to write the pidfile;
-//  - we don't have permission to remove the pidfile;
-//  - we don't have permission to read the pidfile;
-//  - the pidfile contains a negative number;
-//  - the pidfile contains something that is not numeric;
 //  - when we don't have access to procfs to check the ctime of the process in question;
 // - ...
 
+// fakeProcessChecker is a ProcessChecker that reports on an imaginary set of processes.
+type fakeProcessChecker struct {
+	createTimes map[Pid]time.Time
+	cmdlines    map[Pid]string
+	err         error
+
+	// If set, onCheck is called at the start of each CreateTime call.
+	onCheck func(pid Pid)
+}
+
+var _ ProcessChecker = (*fakeProcessChecker)(nil)
+
+func (c *fakeProcessChecker) CreateTime(ctx context.Context, pid Pid) (time.Time, bool, error) {
+	if c.onCheck != nil {
+		c.onCheck(pid)
+	}
+	if c.err != nil {
+		return time.Time{}, false, c.err
+	}
+	ts, ok := c.createTimes[pid]
+	return ts, ok, nil
+}
+
+func (c *fakeProcessChecker) Cmdline(ctx context.Context, pid Pid) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	return c.cmdlines[pid], nil
+}
+
+// fakeClock is a Clock that always reports the same time.
+type fakeClock time.Time
+
+var _ Clock = fakeClock{}
+
+func (c fakeClock) Now() time.Time {
+	return time.Time(c)
+}
+
 type PidfileLockTestSuite struct {
 	suite.Suite
 
@@ -74,6 +114,31 @@ func (suite *PidfileLockTestSuite) makePidfile(valid bool) {
 	}
 }
 
+// writePidfile writes a pidfile containing the given pid with the given mtime.
+func (suite *PidfileLockTestSuite) writePidfile(pid Pid, mtime time.Time) {
+	t := suite.T()
+
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte(fmt.Sprintf("%d", pid)), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+	if err := os.Chtimes(suite.pidfilePath, mtime, mtime); err != nil {
+		t.Fatalf("failed to set pidfile mtime: %v", err)
+	}
+}
+
+// writeForeignPidfile writes a pidfile recording that the lock was taken by the current process's pid on another host.
+func (suite *PidfileLockTestSuite) writeForeignPidfile() {
+	t := suite.T()
+
+	d := fmt.Sprintf("%d\nhostname=%s\n", os.Getpid(), foreignHostname)
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte(d), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+}
+
+// foreignHostname is assumed not to be the name of the host running the tests.
+const foreignHostname = "pidfile-test.invalid"
+
 func (suite *PidfileLockTestSuite) assertPidfile(exists bool) {
 	t := suite.T()
 
@@ -110,6 +175,37 @@ func (suite *PidfileLockTestSuite) TestHolder_Invalid() {
 	assert.Nil(t, err)
 }
 
+// notExistCodec is a PidfileCodec whose Decode always fails with err.
+type notExistCodec struct {
+	textCodec
+	err error
+}
+
+func (c notExistCodec) Decode(r io.Reader) (Pid, Meta, error) {
+	return 0, nil, c.err
+}
+
+// Any form of not-exist error should mean that there is no lock.
+func (suite *PidfileLockTestSuite) TestHolder_WrappedNotExist() {
+	t := suite.T()
+
+	suite.makePidfile(true)
+
+	for _, err := range []error{
+		os.ErrNotExist,
+		fmt.Errorf("wrapped: %w", os.ErrNotExist),
+		fmt.Errorf("wrapped: %w", &os.PathError{Op: "open", Path: suite.pidfilePath, Err: syscall.ENOENT}),
+		syscall.ENOENT,
+	} {
+		pl, err := NewLock(suite.pidfilePath, WithCodec(notExistCodec{err: err}))
+		assert.Nil(t, err)
+
+		pid, err := pl.Holder()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(0), pid)
+	}
+}
+
 // If the lock is currently held, Holder should succeed.
 func (suite *PidfileLockTestSuite) TestHolder_Exist() {
 	t := suite.T()
@@ -121,79 +217,1515 @@ func (suite *PidfileLockTestSuite) TestHolder_Exist() {
 	assert.Nil(t, err)
 }
 
-// If the pidfile does not exist, we should be able to take the lock.
-func (suite *PidfileLockTestSuite) TestLock_NotExist() {
+// If the process named in the pidfile was created before the pidfile was written, it holds the lock.
+func (suite *PidfileLockTestSuite) TestHolder_CreatedBeforeMtime() {
 	t := suite.T()
 
-	err := suite.pl.Lock(0)
+	mtime := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	suite.writePidfile(4213, mtime)
+	suite.pl.checker = &fakeProcessChecker{createTimes: map[Pid]time.Time{4213: mtime.Add(-time.Hour)}}
+
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(4213), pid)
+}
+
+// If the process named in the pidfile was created after the pidfile was written, the pid has been reused and the lock
+// is not held.
+func (suite *PidfileLockTestSuite) TestHolder_CreatedAfterMtime() {
+	t := suite.T()
+
+	mtime := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	suite.writePidfile(4213, mtime)
+	suite.pl.checker = &fakeProcessChecker{createTimes: map[Pid]time.Time{4213: mtime.Add(time.Hour)}}
+
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(0), pid)
+}
+
+// Validity should be decided with millisecond precision, even when the process was created in the same second that
+// the pidfile was written.
+func (suite *PidfileLockTestSuite) TestHolder_SameSecond() {
+	t := suite.T()
+
+	mtime := time.Date(2017, time.June, 1, 12, 0, 0, int(600*time.Millisecond), time.UTC)
+	for _, c := range []struct {
+		createTime time.Time
+		held       bool
+	}{
+		{mtime.Add(-200 * time.Millisecond), true},
+		{mtime.Add(-time.Millisecond), true},
+		{mtime.Add(100 * time.Microsecond), false}, // Same millisecond as the mtime.
+		{mtime.Add(100 * time.Millisecond), false},
+	} {
+		suite.writePidfile(4213, mtime)
+		suite.pl.checker = &fakeProcessChecker{createTimes: map[Pid]time.Time{4213: c.createTime}}
+
+		pid, err := suite.pl.Holder()
+		assert.Nil(t, err)
+		assert.Equal(t, c.held, pid == Pid(4213), "create time %v", c.createTime)
+	}
+}
+
+// With a grace window, a process created shortly after the pidfile was written is still the holder.
+func (suite *PidfileLockTestSuite) TestHolder_ValidityGrace() {
+	t := suite.T()
+
+	suite.pl.opts.validityGrace = 50 * time.Millisecond
+
+	mtime := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		createTime time.Time
+		held       bool
+	}{
+		{mtime.Add(-time.Hour), true},
+		{mtime.Add(10 * time.Millisecond), true},
+		{mtime.Add(49 * time.Millisecond), true},
+		{mtime.Add(50 * time.Millisecond), false},
+		{mtime.Add(time.Hour), false},
+	} {
+		suite.writePidfile(4213, mtime)
+		suite.pl.checker = &fakeProcessChecker{createTimes: map[Pid]time.Time{4213: c.createTime}}
+
+		pid, err := suite.pl.Holder()
+		assert.Nil(t, err)
+		assert.Equal(t, c.held, pid == Pid(4213), "create time %v", c.createTime)
+	}
+}
+
+// If the process named in the pidfile does not exist, the lock is not held.
+func (suite *PidfileLockTestSuite) TestHolder_NoProcess() {
+	t := suite.T()
+
+	suite.writePidfile(4213, time.Now())
+	suite.pl.checker = &fakeProcessChecker{}
+
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(0), pid)
+}
+
+// If the process cannot be inspected, Holder should fail rather than guess.
+func (suite *PidfileLockTestSuite) TestHolder_CheckerError() {
+	t := suite.T()
+
+	suite.writePidfile(4213, time.Now())
+	suite.pl.checker = &fakeProcessChecker{err: fmt.Errorf("procfs unavailable")}
+
+	pid, err := suite.pl.Holder()
+	assert.NotNil(t, err)
+	assert.Equal(t, Pid(0), pid)
+}
+
+// With a TTL, a lock whose pidfile is older than the TTL is not held, even if its holder is alive; and a lock whose
+// holder cannot be inspected is held until it expires.
+func (suite *PidfileLockTestSuite) TestHolder_LockTTL() {
+	t := suite.T()
+
+	now := time.Now()
+	suite.pl.opts.clock = fakeClock(now)
+	suite.pl.opts.lockTTL = time.Minute
+
+	suite.pl.checker = &fakeProcessChecker{createTimes: map[Pid]time.Time{4213: now.Add(-time.Hour)}}
+	suite.writePidfile(4213, now.Add(-30*time.Second))
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(4213), pid)
+
+	suite.writePidfile(4213, now.Add(-2*time.Minute))
+	pid, err = suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(0), pid)
+
+	info, err := suite.pl.DebugInfo()
+	assert.Nil(t, err)
+	assert.True(t, info.Expired)
+	assert.False(t, info.Valid)
+
+	// An expired lock can be taken over.
+	assert.Nil(t, suite.pl.Lock(0))
+
+	suite.pl.checker = &fakeProcessChecker{err: fmt.Errorf("procfs unavailable")}
+	suite.writePidfile(4213, now.Add(-30*time.Second))
+	pid, err = suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(4213), pid)
+
+	suite.writePidfile(4213, now.Add(-2*time.Minute))
+	pid, err = suite.pl.Holder()
 	assert.Nil(t, err)
+	assert.Equal(t, Pid(0), pid)
+}
+
+// If the process checker wedges, HolderWithContext and UnlockWithContext should give up when their context ends.
+func (suite *PidfileLockTestSuite) TestHolderWithContext_Canceled() {
+	t := suite.T()
 
+	suite.writePidfile(4213, time.Now())
+	suite.pl.checker = CreateTimeFunc(func(ctx context.Context, pid Pid) (time.Time, bool, error) {
+		<-ctx.Done()
+		return time.Time{}, false, ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	pid, err := suite.pl.HolderWithContext(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	assert.Equal(t, Pid(0), pid)
+
+	err = suite.pl.UnlockWithContext(ctx, 4213)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
 	suite.assertPidfile(true)
 }
 
-// If the pidfile exists but the lock is not valid, we should be able to take the lock as normal.
-func (suite *PidfileLockTestSuite) TestLock_Invalid() {
+// HolderInfo should describe a valid holder.
+func (suite *PidfileLockTestSuite) TestHolderInfo() {
 	t := suite.T()
 
-	suite.makePidfile(false)
+	mtime := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	createTime := mtime.Add(-time.Hour)
+	suite.writePidfile(4213, mtime)
+	suite.pl.checker = &fakeProcessChecker{
+		createTimes: map[Pid]time.Time{4213: createTime},
+		cmdlines:    map[Pid]string{4213: "/usr/bin/myd --config=/etc/x"},
+	}
 
-	err := suite.pl.Lock(0)
+	info, err := suite.pl.HolderInfo()
 	assert.Nil(t, err)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, Pid(4213), info.Pid)
+		assert.True(t, createTime.Equal(info.CreateTime))
+		assert.Equal(t, "/usr/bin/myd --config=/etc/x", info.Cmdline)
+	}
 }
 
-// If the pidfile exists and the lock is valid, we should get an error when we try to take the lock.
-func (suite *PidfileLockTestSuite) TestLock_Exist() {
+// HolderInfo should work against real processes, too.
+func (suite *PidfileLockTestSuite) TestHolderInfo_Exist() {
 	t := suite.T()
 
 	suite.makePidfile(true)
 
-	err := suite.pl.Lock(0)
-	assert.Equal(t, os.ErrExist, err)
+	info, err := suite.pl.HolderInfo()
+	assert.Nil(t, err)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, Pid(os.Getpid()), info.Pid)
+		assert.NotEqual(t, "", info.Cmdline)
+	}
 }
 
-// If the pidfile does not exist, Unlock should fail.
-func (suite *PidfileLockTestSuite) TestUnlock_NotExist() {
+// If there is no valid holder, HolderInfo should return nil.
+func (suite *PidfileLockTestSuite) TestHolderInfo_NoHolder() {
 	t := suite.T()
 
-	err := suite.pl.Unlock(0)
-	assert.Equal(t, os.ErrNotExist, err)
+	info, err := suite.pl.HolderInfo()
+	assert.Nil(t, err)
+	assert.Nil(t, info)
+
+	suite.makePidfile(false)
+
+	info, err = suite.pl.HolderInfo()
+	assert.Nil(t, err)
+	assert.Nil(t, info)
 }
 
-// If the lock is invalid, it is already unlocked, so Unlock should fail.
-func (suite *PidfileLockTestSuite) TestUnlock_Invalid() {
+// HolderProcess should return a handle on the holder of a valid lock, nil if there is none, and an error if the
+// holder is on another host.
+func (suite *PidfileLockTestSuite) TestHolderProcess() {
 	t := suite.T()
 
+	proc, err := suite.pl.HolderProcess()
+	assert.Nil(t, err)
+	assert.Nil(t, proc)
+
 	suite.makePidfile(false)
+	proc, err = suite.pl.HolderProcess()
+	assert.Nil(t, err)
+	assert.Nil(t, proc)
 
-	err := suite.pl.Unlock(0)
-	assert.Equal(t, os.ErrNotExist, err)
+	suite.makePidfile(true)
+	proc, err = suite.pl.HolderProcess()
+	assert.Nil(t, err)
+	if assert.NotNil(t, proc) {
+		assert.Equal(t, int32(os.Getpid()), proc.Pid)
+	}
 
-	suite.assertPidfile(true)
+	suite.writeForeignPidfile()
+	_, err = suite.pl.HolderProcess()
+	assert.NotNil(t, err)
 }
 
-// If the pid passed to Unlock doesn't match what is in the pidfile, the lock should not be released.
-func (suite *PidfileLockTestSuite) TestUnlock_NotOwner() {
+// IsStale should be true only if the pidfile exists but is not a valid lock.
+func (suite *PidfileLockTestSuite) TestIsStale() {
 	t := suite.T()
 
-	// XXX: We assume that pid 1 has been around for a long time.
-	if err := ioutil.WriteFile(suite.pidfilePath, []byte("1"), os.FileMode(0644)); err != nil {
+	stale, err := suite.pl.IsStale()
+	assert.Nil(t, err)
+	assert.False(t, stale)
+
+	suite.makePidfile(false)
+
+	stale, err = suite.pl.IsStale()
+	assert.Nil(t, err)
+	assert.True(t, stale)
+
+	suite.makePidfile(true)
+
+	stale, err = suite.pl.IsStale()
+	assert.Nil(t, err)
+	assert.False(t, stale)
+}
+
+// If the pidfile cannot be parsed, IsStale should fail.
+func (suite *PidfileLockTestSuite) TestIsStale_Malformed() {
+	t := suite.T()
+
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte("garbage"), os.FileMode(0644)); err != nil {
 		t.Fatalf("failed to write pidfile: %v", err)
 	}
 
-	err := suite.pl.Unlock(0)
+	stale, err := suite.pl.IsStale()
 	assert.NotNil(t, err)
+	assert.False(t, stale)
+}
+
+// An empty pidfile is stale, and Lock should replace it; but Read should still report it.
+func (suite *PidfileLockTestSuite) TestLock_Empty() {
+	t := suite.T()
+
+	for _, contents := range []string{"", " \n"} {
+		if err := ioutil.WriteFile(suite.pidfilePath, []byte(contents), os.FileMode(0644)); err != nil {
+			t.Fatalf("failed to write pidfile: %v", err)
+		}
+
+		_, _, err := suite.pl.Read()
+		assert.True(t, errors.Is(err, ErrEmptyPidfile), "unexpected error: %v", err)
+		assert.True(t, errors.Is(err, ErrMalformedPidfile), "unexpected error: %v", err)
+
+		pid, err := suite.pl.Holder()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(0), pid)
+
+		stale, err := suite.pl.IsStale()
+		assert.Nil(t, err)
+		assert.True(t, stale)
+
+		held, err := suite.pl.QuickCheck()
+		assert.Nil(t, err)
+		assert.False(t, held)
+
+		assert.Nil(t, suite.pl.Lock(0))
+		pid, err = suite.pl.Holder()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(os.Getpid()), pid)
+		assert.Nil(t, suite.pl.Unlock(0))
+	}
+}
+
+// RemoveIfStale should remove a stale pidfile, and nothing else.
+func (suite *PidfileLockTestSuite) TestPeek() {
+	t := suite.T()
+
+	pid, mtime, valid, err := suite.pl.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(0), pid)
+	assert.True(t, mtime.IsZero())
+	assert.False(t, valid)
+
+	for _, v := range []bool{false, true} {
+		suite.makePidfile(v)
+		st, err := os.Stat(suite.pidfilePath)
+		assert.Nil(t, err)
 
+		pid, mtime, valid, err := suite.pl.Peek()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(os.Getpid()), pid)
+		assert.True(t, st.ModTime().Equal(mtime))
+		assert.Equal(t, v, valid)
+	}
+}
+
+// RemoveIfStale should remove the pidfile only if it exists but is not a valid lock.
+func (suite *PidfileLockTestSuite) TestRemoveIfStale() {
+	t := suite.T()
+
+	mtime := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	suite.pl.checker = &fakeProcessChecker{createTimes: map[Pid]time.Time{
+		4213: mtime.Add(-time.Hour), // Live holder.
+		4214: mtime.Add(time.Hour),  // Pid reused after the pidfile was written.
+	}}
+
+	// Absent.
+	removed, err := suite.pl.RemoveIfStale()
+	assert.Nil(t, err)
+	assert.False(t, removed)
+
+	// Held by a live process.
+	suite.writePidfile(4213, mtime)
+	removed, err = suite.pl.RemoveIfStale()
+	assert.Nil(t, err)
+	assert.False(t, removed)
 	suite.assertPidfile(true)
+
+	// Stale because of pid reuse.
+	suite.writePidfile(4214, mtime)
+	removed, err = suite.pl.RemoveIfStale()
+	assert.Nil(t, err)
+	assert.True(t, removed)
+	suite.assertPidfile(false)
+
+	// Stale because the process is gone.
+	suite.writePidfile(4215, mtime)
+	removed, err = suite.pl.RemoveIfStale()
+	assert.Nil(t, err)
+	assert.True(t, removed)
+	suite.assertPidfile(false)
 }
 
-// If the pid we pass to Unlock owns the lock, it should be successfully released.
-func (suite *PidfileLockTestSuite) TestUnlock_Owner() {
+// A lock taken on another host is considered held, even though the local process with the same pid is ours.
+func (suite *PidfileLockTestSuite) TestForeignHost() {
 	t := suite.T()
 
-	suite.makePidfile(true)
+	suite.writeForeignPidfile()
 
-	err := suite.pl.Unlock(0)
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+
+	info, err := suite.pl.HolderInfo()
+	assert.Nil(t, err)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, foreignHostname, info.Hostname)
+		assert.Equal(t, "", info.Cmdline)
+	}
+
+	stale, err := suite.pl.IsStale()
+	assert.Nil(t, err)
+	assert.False(t, stale)
+
+	removed, err := suite.pl.RemoveIfStale()
+	assert.Nil(t, err)
+	assert.False(t, removed)
+
+	err = suite.pl.Lock(0)
+	var heldErr *ErrLockHeld
+	if assert.True(t, errors.As(err, &heldErr), "unexpected error: %v", err) {
+		assert.Equal(t, foreignHostname, heldErr.Hostname)
+	}
+
+	err = suite.pl.Unlock(0)
+	assert.True(t, errors.As(err, new(*ErrNotOwner)), "unexpected error: %v", err)
+	err = suite.pl.HandOff(1)
+	assert.True(t, errors.As(err, new(*ErrNotOwner)), "unexpected error: %v", err)
+	err = suite.pl.Touch()
+	assert.True(t, errors.As(err, new(*ErrNotOwner)), "unexpected error: %v", err)
+	err = suite.pl.Relocate(filepath.Join(suite.base, "moved.pid"))
+	var notOwnerErr *ErrNotOwner
+	if assert.True(t, errors.As(err, &notOwnerErr), "unexpected error: %v", err) {
+		assert.Equal(t, foreignHostname, notOwnerErr.Hostname)
+	}
+
+	debugInfo, err := suite.pl.DebugInfo()
+	assert.Nil(t, err)
+	assert.True(t, debugInfo.Foreign)
+	assert.True(t, debugInfo.Valid)
+
+	suite.assertPidfile(true)
+}
+
+// A pidfile that records the local hostname is validated as usual.
+func (suite *PidfileLockTestSuite) TestLocalHost() {
+	t := suite.T()
+
+	hostname, err := os.Hostname()
+	assert.Nil(t, err)
+
+	d := fmt.Sprintf("%d\nhostname=%s\n", os.Getpid(), hostname)
+	assert.Nil(t, ioutil.WriteFile(suite.pidfilePath, []byte(d), os.FileMode(0644)))
+	ts := time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+	assert.Nil(t, os.Chtimes(suite.pidfilePath, ts, ts))
+
+	stale, err := suite.pl.IsStale()
 	assert.Nil(t, err)
+	assert.True(t, stale)
 
+	assert.Nil(t, suite.pl.Lock(0))
+	assert.Nil(t, suite.pl.Unlock(0))
 	suite.assertPidfile(false)
 }
+
+// A lock recorded during a previous boot is stale, even though its process appears to be running.
+func (suite *PidfileLockTestSuite) TestBootID() {
+	t := suite.T()
+
+	defer func(path string) {
+		bootIDPath = path
+	}(bootIDPath)
+	bootIDPath = filepath.Join(suite.base, "boot_id")
+	setBootID := func(id string) {
+		if err := ioutil.WriteFile(bootIDPath, []byte(id+"\n"), os.FileMode(0644)); err != nil {
+			t.Fatalf("failed to write boot ID: %v", err)
+		}
+	}
+
+	setBootID("before-reboot")
+	p, err := New(suite.pidfilePath, WithBootID(true))
+	assert.Nil(t, err)
+	assert.Nil(t, p.Write(0))
+
+	d, err := ioutil.ReadFile(suite.pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("%d\nboot_id=before-reboot\n", os.Getpid()), string(d))
+
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+
+	setBootID("after-reboot")
+	stale, err := suite.pl.IsStale()
+	assert.Nil(t, err)
+	assert.True(t, stale)
+
+	info, err := suite.pl.DebugInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, "before-reboot", info.RecordedBootID)
+	assert.False(t, info.Valid)
+
+	// If the current boot ID cannot be read, the lock is validated as if none had been recorded.
+	assert.Nil(t, os.Remove(bootIDPath))
+	pid, err = suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+}
+
+// With SignalChecker, any running process with the recorded pid holds the lock, regardless of the pidfile's mtime.
+func (suite *PidfileLockTestSuite) TestHolder_SignalChecker() {
+	t := suite.T()
+
+	pl, err := NewLock(suite.pidfilePath, WithProcessChecker(SignalChecker{}))
+	assert.Nil(t, err)
+
+	suite.makePidfile(false)
+
+	pid, err := pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+
+	// XXX: We assume that no process has the largest possible pid.
+	suite.writePidfile(MaxPid, time.Now())
+
+	pid, err = pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(0), pid)
+}
+
+// If several goroutines try to take the lock at once, exactly one of them should succeed.
+func (suite *PidfileLockTestSuite) TestLock_Goroutines() {
+	t := suite.T()
+
+	const n = 50
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- suite.pl.Lock(0)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		var heldErr *ErrLockHeld
+		assert.True(t, errors.As(err, &heldErr), "unexpected error: %v", err)
+	}
+	assert.Equal(t, 1, succeeded)
+}
+
+// If we cannot write the pidfile, Lock should say so rather than reporting that the lock is held.
+func (suite *PidfileLockTestSuite) TestLock_CannotWrite() {
+	t := suite.T()
+
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	if err := os.Chmod(suite.base, os.FileMode(0555)); err != nil {
+		t.Fatalf("failed to change permissions: %v", err)
+	}
+	defer func() {
+		_ = os.Chmod(suite.base, os.FileMode(0755))
+	}()
+
+	err := suite.pl.Lock(0)
+	var cwErr *ErrCannotWrite
+	assert.True(t, errors.As(err, &cwErr), "unexpected error: %v", err)
+	assert.True(t, errors.Is(err, os.ErrPermission))
+}
+
+// If we cannot read the pidfile, Holder should say so rather than reporting that the lock is not held.
+func (suite *PidfileLockTestSuite) TestHolder_CannotRead() {
+	t := suite.T()
+
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	suite.makePidfile(true)
+	if err := os.Chmod(suite.pidfilePath, os.FileMode(0)); err != nil {
+		t.Fatalf("failed to change permissions: %v", err)
+	}
+
+	_, err := suite.pl.Holder()
+	assert.True(t, errors.Is(err, os.ErrPermission), "unexpected error: %v", err)
+}
+
+// If the pidfile does not exist, we should be able to take the lock.
+func (suite *PidfileLockTestSuite) TestLock_NotExist() {
+	t := suite.T()
+
+	err := suite.pl.Lock(0)
+	assert.Nil(t, err)
+
+	suite.assertPidfile(true)
+}
+
+// A lock taken by a process created at exactly the time the lock was taken is not valid, since the process must have
+// been running before it could write the pidfile.
+func (suite *PidfileLockTestSuite) TestLock_CreatedAtMtime() {
+	t := suite.T()
+
+	now := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	pid := Pid(os.Getpid())
+	for _, c := range []struct {
+		createTime time.Time
+		held       bool
+	}{
+		{now.Add(-time.Second), true},
+		{now, false},
+	} {
+		pl, err := NewLock(suite.pidfilePath, WithClock(fakeClock(now)))
+		assert.Nil(t, err)
+		pl.(*pidfileLock).checker = &fakeProcessChecker{createTimes: map[Pid]time.Time{pid: c.createTime}}
+
+		_ = os.Remove(suite.pidfilePath)
+		err = pl.Lock(0)
+		assert.Nil(t, err)
+
+		st, err := os.Stat(suite.pidfilePath)
+		assert.Nil(t, err)
+		assert.True(t, now.Equal(st.ModTime()))
+
+		holder, err := pl.Holder()
+		assert.Nil(t, err)
+		assert.Equal(t, c.held, holder == pid)
+	}
+}
+
+// If the pidfile exists but the lock is not valid, we should be able to take the lock as normal.
+func (suite *PidfileLockTestSuite) TestLock_Invalid() {
+	t := suite.T()
+
+	suite.makePidfile(false)
+
+	err := suite.pl.Lock(0)
+	assert.Nil(t, err)
+}
+
+// If a worker exits and a new process reuses its pid shortly after its pidfile was written, the pidfile is stale, and
+// the new process should be able to replace it.
+func (suite *PidfileLockTestSuite) TestLock_PidReused() {
+	t := suite.T()
+
+	mtime := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	now := mtime.Add(time.Second)
+	for _, createTime := range []time.Time{
+		mtime.Add(100 * time.Microsecond), // Same millisecond as the mtime.
+		mtime.Add(time.Millisecond),
+	} {
+		suite.writePidfile(4213, mtime)
+
+		pl, err := NewLock(suite.pidfilePath, WithClock(fakeClock(now)))
+		assert.Nil(t, err)
+		pl.(*pidfileLock).checker = &fakeProcessChecker{createTimes: map[Pid]time.Time{4213: createTime}}
+
+		holder, err := pl.Holder()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(0), holder, "create time %v", createTime)
+
+		assert.Nil(t, pl.Lock(4213))
+
+		pid, lockMtime, err := pl.Read()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(4213), pid)
+		assert.True(t, now.Equal(lockMtime))
+
+		holder, err = pl.Holder()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(4213), holder, "create time %v", createTime)
+	}
+}
+
+// If the pidfile exists and the lock is valid, we should get an error when we try to take the lock.
+func (suite *PidfileLockTestSuite) TestLock_Exist() {
+	t := suite.T()
+
+	suite.makePidfile(true)
+
+	err := suite.pl.Lock(0)
+	var heldErr *ErrLockHeld
+	if assert.True(t, errors.As(err, &heldErr)) {
+		assert.Equal(t, Pid(os.Getpid()), heldErr.Pid)
+	}
+	assert.True(t, errors.Is(err, os.ErrExist))
+}
+
+// Options passed to NewLock should also apply to the pidfile that Lock writes.
+func (suite *PidfileLockTestSuite) TestLock_PidfileOptions() {
+	t := suite.T()
+
+	pl, err := NewLock(suite.pidfilePath, WithTerminator(""), WithFileMode(0600))
+	assert.Nil(t, err)
+	assert.Nil(t, pl.Lock(0))
+
+	d, err := ioutil.ReadFile(suite.pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("%d", os.Getpid()), string(d))
+
+	st, err := os.Stat(suite.pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), st.Mode().Perm())
+}
+
+// If asked to record a pid that no process could have, Lock and Write should fail rather than leave behind a pidfile
+// that would stop anyone from taking the lock.
+func (suite *PidfileLockTestSuite) TestLock_InvalidPid() {
+	t := suite.T()
+
+	fl, err := NewFlockLock(suite.pidfilePath)
+	assert.Nil(t, err)
+
+	// Where MaxPid is the largest Pid, maxPid+1 wraps around to a negative pid, which is just as invalid.
+	maxPid := MaxPid
+	for _, pid := range []Pid{-5, maxPid + 1} {
+		assert.NotNil(t, suite.pl.Lock(pid), "pid %d", pid)
+		suite.assertPidfile(false)
+		assert.NotNil(t, suite.pl.Write(pid), "pid %d", pid)
+		suite.assertPidfile(false)
+		assert.NotNil(t, fl.Lock(pid), "pid %d", pid)
+		suite.assertPidfile(false)
+	}
+
+	assert.Nil(t, suite.pl.Lock(0))
+}
+
+// With WithPreserveMode, Lock should give the pidfile the permissions of the stale one that it replaces.
+func (suite *PidfileLockTestSuite) TestLock_PreserveMode() {
+	t := suite.T()
+
+	suite.makePidfile(false)
+	assert.Nil(t, os.Chmod(suite.pidfilePath, os.FileMode(0600)))
+
+	pl, err := NewLock(suite.pidfilePath, WithPreserveMode(true))
+	assert.Nil(t, err)
+	assert.Nil(t, pl.Lock(0))
+	suite.assertPidfile(true)
+
+	st, err := os.Stat(suite.pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), st.Mode().Perm())
+}
+
+// If a logger is set, it should be told of each decision and change that Lock and Unlock make.
+func (suite *PidfileLockTestSuite) TestLogger() {
+	t := suite.T()
+
+	var events []string
+	pl, err := NewLock(suite.pidfilePath, WithLogger(func(event string, fields map[string]interface{}) {
+		assert.Equal(t, suite.pidfilePath, fields["path"])
+		events = append(events, event)
+	}))
+	assert.Nil(t, err)
+
+	suite.makePidfile(false)
+	assert.Nil(t, pl.Lock(0))
+	assert.Equal(t, []string{"lock.stale", "lock.stale_removed", "lock.acquired"}, events)
+
+	events = nil
+	assert.Nil(t, pl.Unlock(0))
+	assert.Equal(t, []string{"lock.holder_alive", "lock.released"}, events)
+}
+
+// If nobody holds the lock, LockWithContext should take it immediately.
+func (suite *PidfileLockTestSuite) TestLockWithContext_NotExist() {
+	t := suite.T()
+
+	err := suite.pl.LockWithContext(context.Background(), 0)
+	assert.Nil(t, err)
+
+	suite.assertPidfile(true)
+}
+
+// If the lock stays held, LockWithContext should give up when the context ends.
+func (suite *PidfileLockTestSuite) TestLockWithContext_Timeout() {
+	t := suite.T()
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte("1"), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	pl, err := NewLock(suite.pidfilePath, WithPollInterval(10*time.Millisecond))
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = pl.LockWithContext(ctx, 0)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	pid, err := pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1), pid)
+}
+
+// If the lock is released while LockWithContext is waiting, it should take the lock.
+func (suite *PidfileLockTestSuite) TestLockWithContext_Released() {
+	t := suite.T()
+
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte("1"), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	pl, err := NewLock(suite.pidfilePath, WithPollInterval(10*time.Millisecond))
+	assert.Nil(t, err)
+
+	path := suite.pidfilePath
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.Remove(path)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = pl.LockWithContext(ctx, 0)
+	assert.Nil(t, err)
+
+	pid, err := pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+}
+
+// If nobody holds the lock, WaitForRelease should return immediately.
+func (suite *PidfileLockTestSuite) TestWaitForRelease_NotExist() {
+	t := suite.T()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Nil(t, suite.pl.WaitForRelease(ctx))
+}
+
+// If the lock is held until the context ends, WaitForRelease should return the context's error.
+func (suite *PidfileLockTestSuite) TestWaitForRelease_Timeout() {
+	t := suite.T()
+
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte("1"), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	pl, err := NewLock(suite.pidfilePath, WithPollInterval(10*time.Millisecond))
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = pl.WaitForRelease(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	suite.assertPidfile(true)
+}
+
+// If the poll interval is not positive, the methods that wait for the lock should use the default rather than panic.
+func (suite *PidfileLockTestSuite) TestPollInterval_NotPositive() {
+	t := suite.T()
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte("1"), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	for _, d := range []time.Duration{0, -time.Second} {
+		pl, err := NewLock(suite.pidfilePath, WithPollInterval(d))
+		assert.Nil(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		assert.Equal(t, context.DeadlineExceeded, pl.WaitForRelease(ctx))
+		cancel()
+
+		ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+		assert.Equal(t, context.DeadlineExceeded, pl.LockWithContext(ctx, 0))
+		cancel()
+	}
+}
+
+// WaitForRelease should return once the lock is released, without taking it.
+func (suite *PidfileLockTestSuite) TestWaitForRelease_Released() {
+	t := suite.T()
+
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte("1"), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	pl, err := NewLock(suite.pidfilePath, WithPollInterval(10*time.Millisecond))
+	assert.Nil(t, err)
+
+	path := suite.pidfilePath
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.Remove(path)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Nil(t, pl.WaitForRelease(ctx))
+	suite.assertPidfile(false)
+}
+
+// If another process takes the lock while we are examining a stale pidfile, Lock must not replace its pidfile.
+func (suite *PidfileLockTestSuite) TestLock_Race() {
+	t := suite.T()
+
+	mtime := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	suite.writePidfile(4213, mtime)
+
+	checker := &fakeProcessChecker{createTimes: map[Pid]time.Time{
+		4213: mtime.Add(time.Hour), // 4213 has been reused, so the existing pidfile is stale.
+		4214: mtime.Add(-time.Hour),
+	}}
+	checker.onCheck = func(pid Pid) {
+		if pid == 4213 {
+			// Simulate another process clearing away the stale pidfile and taking the lock.
+			_ = os.Remove(suite.pidfilePath)
+			suite.writePidfile(4214, mtime.Add(time.Minute))
+		}
+	}
+	suite.pl.checker = checker
+
+	err := suite.pl.Lock(0)
+	var heldErr *ErrLockHeld
+	if assert.True(t, errors.As(err, &heldErr), "unexpected error: %v", err) {
+		assert.Equal(t, Pid(4214), heldErr.Pid)
+	}
+
+	pid, _, err := suite.pl.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(4214), pid)
+}
+
+// Lock should not leave temporary files behind.
+func (suite *PidfileLockTestSuite) TestLock_NoTemporaryFiles() {
+	t := suite.T()
+
+	suite.makePidfile(false)
+
+	err := suite.pl.Lock(0)
+	assert.Nil(t, err)
+
+	names, err := ioutil.ReadDir(suite.base)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(names))
+}
+
+// The function returned by Acquire should release the lock exactly once.
+func (suite *PidfileLockTestSuite) TestAcquire() {
+	t := suite.T()
+
+	release, err := suite.pl.Acquire(0)
+	assert.Nil(t, err)
+	suite.assertPidfile(true)
+
+	assert.Nil(t, release())
+	suite.assertPidfile(false)
+
+	assert.Nil(t, release())
+}
+
+// If the lock is held, Acquire should fail like Lock.
+func (suite *PidfileLockTestSuite) TestAcquire_Exist() {
+	t := suite.T()
+
+	suite.makePidfile(true)
+
+	release, err := suite.pl.Acquire(0)
+	assert.True(t, errors.Is(err, os.ErrExist))
+	assert.Nil(t, release)
+}
+
+// Closing the io.Closer returned by LockCloser should release the lock exactly once, reporting any error the first
+// time.
+func (suite *PidfileLockTestSuite) TestLockCloser() {
+	t := suite.T()
+
+	closer, err := suite.pl.LockCloser(0)
+	assert.Nil(t, err)
+	suite.assertPidfile(true)
+
+	assert.Nil(t, closer.Close())
+	suite.assertPidfile(false)
+	assert.Nil(t, closer.Close())
+
+	// If the lock has already been released some other way, the first Close reports it.
+	closer, err = suite.pl.LockCloser(0)
+	assert.Nil(t, err)
+	assert.Nil(t, suite.pl.Unlock(0))
+	assert.Equal(t, os.ErrNotExist, closer.Close())
+	assert.Nil(t, closer.Close())
+
+	suite.makePidfile(true)
+	closer, err = suite.pl.LockCloser(0)
+	assert.True(t, errors.Is(err, os.ErrExist))
+	assert.Nil(t, closer)
+}
+
+// Adopt should accept a valid lock that records our pid without rewriting the pidfile.
+func (suite *PidfileLockTestSuite) TestAdopt() {
+	t := suite.T()
+
+	assert.Equal(t, os.ErrNotExist, suite.pl.Adopt(0))
+
+	mtime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	suite.writePidfile(4213, mtime)
+	suite.pl.checker = &fakeProcessChecker{createTimes: map[Pid]time.Time{4213: mtime.Add(-time.Hour)}}
+	assert.Nil(t, suite.pl.Adopt(4213))
+
+	pid, after, err := suite.pl.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(4213), pid)
+	assert.True(t, mtime.Equal(after), "mtime %v, expected %v", after, mtime)
+
+	err = suite.pl.Adopt(4214)
+	var notOwnerErr *ErrNotOwner
+	if assert.True(t, errors.As(err, &notOwnerErr), "unexpected error: %v", err) {
+		assert.Equal(t, Pid(4213), notOwnerErr.Holder)
+		assert.Equal(t, Pid(4214), notOwnerErr.Caller)
+	}
+
+	// A pidfile written before its process was created is not a valid lock.
+	suite.pl.checker = &fakeProcessChecker{createTimes: map[Pid]time.Time{4213: mtime.Add(time.Hour)}}
+	err = suite.pl.Adopt(4213)
+	assert.NotNil(t, err)
+	assert.False(t, errors.As(err, &notOwnerErr))
+}
+
+// If the pidfile does not exist, Unlock should fail.
+func (suite *PidfileLockTestSuite) TestUnlock_NotExist() {
+	t := suite.T()
+
+	err := suite.pl.Unlock(0)
+	assert.Equal(t, os.ErrNotExist, err)
+}
+
+// If the lock is invalid, it is already unlocked, so Unlock should fail.
+func (suite *PidfileLockTestSuite) TestUnlock_Invalid() {
+	t := suite.T()
+
+	suite.makePidfile(false)
+
+	err := suite.pl.Unlock(0)
+	assert.Equal(t, os.ErrNotExist, err)
+
+	suite.assertPidfile(true)
+}
+
+// If the pid passed to Unlock doesn't match what is in the pidfile, the lock should not be released.
+func (suite *PidfileLockTestSuite) TestUnlock_NotOwner() {
+	t := suite.T()
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte("1"), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	err := suite.pl.Unlock(0)
+	var notOwnerErr *ErrNotOwner
+	if assert.True(t, errors.As(err, &notOwnerErr), "unexpected error: %v", err) {
+		assert.Equal(t, Pid(1), notOwnerErr.Holder)
+		assert.Equal(t, Pid(os.Getpid()), notOwnerErr.Caller)
+		assert.Equal(t, fmt.Sprintf("pidfile is held by 1; lock cannot be released by %d", os.Getpid()), err.Error())
+	}
+
+	suite.assertPidfile(true)
+}
+
+// If the pid we pass to Unlock owns the lock, it should be successfully released.
+func (suite *PidfileLockTestSuite) TestUnlock_Owner() {
+	t := suite.T()
+
+	suite.makePidfile(true)
+
+	err := suite.pl.Unlock(0)
+	assert.Nil(t, err)
+
+	suite.assertPidfile(false)
+}
+
+// SelfPid is the current process, and means the same thing as 0.
+func (suite *PidfileLockTestSuite) TestSelfPid() {
+	t := suite.T()
+
+	assert.Nil(t, suite.pl.Lock(SelfPid))
+
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+
+	assert.Nil(t, suite.pl.Unlock(0))
+
+	assert.Nil(t, suite.pl.Lock(0))
+	assert.Nil(t, suite.pl.Unlock(SelfPid))
+	suite.assertPidfile(false)
+}
+
+// If another process holds the lock, Steal should take it from them anyway.
+func (suite *PidfileLockTestSuite) TestSteal() {
+	t := suite.T()
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte("1"), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	err := suite.pl.Steal(0)
+	assert.Nil(t, err)
+
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+}
+
+// ForceUnlock should remove the pidfile even though another process holds the lock.
+func (suite *PidfileLockTestSuite) TestForceUnlock() {
+	t := suite.T()
+
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte("1"), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	err := suite.pl.ForceUnlock()
+	assert.Nil(t, err)
+
+	suite.assertPidfile(false)
+}
+
+// If the pidfile does not exist, ForceUnlock should fail.
+func (suite *PidfileLockTestSuite) TestForceUnlock_NotExist() {
+	t := suite.T()
+
+	err := suite.pl.ForceUnlock()
+	assert.Equal(t, os.ErrNotExist, err)
+}
+
+// If we hold the lock, handing it off should make the successor the holder.
+func (suite *PidfileLockTestSuite) TestHandOff_Owner() {
+	t := suite.T()
+
+	suite.makePidfile(true)
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	err := suite.pl.HandOff(1)
+	assert.Nil(t, err)
+
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1), pid)
+}
+
+// If another process holds the lock, we should not be able to hand it off.
+func (suite *PidfileLockTestSuite) TestHandOff_NotOwner() {
+	t := suite.T()
+
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte("1"), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	err := suite.pl.HandOff(Pid(os.Getpid()))
+	assert.True(t, errors.As(err, new(*ErrNotOwner)), "unexpected error: %v", err)
+
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1), pid)
+}
+
+// If nobody holds the lock, there is nothing to hand off.
+func (suite *PidfileLockTestSuite) TestHandOff_NotExist() {
+	t := suite.T()
+
+	err := suite.pl.HandOff(1)
+	assert.Equal(t, os.ErrNotExist, err)
+
+	suite.assertPidfile(false)
+}
+
+// DryRunLock should report whether Lock would succeed, and who holds the lock if not, without touching the pidfile.
+func (suite *PidfileLockTestSuite) TestDryRunLock() {
+	t := suite.T()
+
+	ok, holder, err := suite.pl.DryRunLock(0)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Pid(0), holder)
+	suite.assertPidfile(false)
+
+	// A stale pidfile would be replaced, but is left alone.
+	mtime := time.Now().Add(-time.Hour)
+	suite.writePidfile(MaxPid, mtime)
+	ok, holder, err = suite.pl.DryRunLock(0)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Pid(0), holder)
+	pid, after, err := suite.pl.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, MaxPid, pid)
+	assert.True(t, mtime.Equal(after))
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	suite.writePidfile(1, time.Now())
+	ok, holder, err = suite.pl.DryRunLock(0)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, Pid(1), holder)
+}
+
+// With WithStrictWrite, Lock should refuse to record the pid of a process that is not running.
+func (suite *PidfileLockTestSuite) TestLock_StrictWrite() {
+	t := suite.T()
+
+	suite.pl.opts.strictWrite = true
+
+	// XXX: We assume that MaxPid is not in use.
+	err := suite.pl.Lock(MaxPid)
+	if assert.NotNil(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "no such process"), "unexpected error: %v", err)
+	}
+	suite.assertPidfile(false)
+
+	assert.NotNil(t, suite.pl.Write(MaxPid))
+	suite.assertPidfile(false)
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	assert.Nil(t, suite.pl.Lock(1))
+	assert.Nil(t, suite.pl.ForceUnlock())
+	assert.Nil(t, suite.pl.Lock(0))
+}
+
+// Swap should transfer the lock from its holder to the new pid, whichever process makes the call.
+func (suite *PidfileLockTestSuite) TestSwap() {
+	t := suite.T()
+
+	suite.makePidfile(true)
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	assert.Nil(t, suite.pl.Swap(SelfPid, 1))
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1), pid)
+
+	assert.Nil(t, suite.pl.Swap(1, SelfPid))
+	pid, err = suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+}
+
+// If oldPid does not hold the lock, Swap should fail and leave the pidfile alone.
+func (suite *PidfileLockTestSuite) TestSwap_Mismatch() {
+	t := suite.T()
+
+	suite.makePidfile(true)
+
+	err := suite.pl.Swap(1, SelfPid)
+	var notOwnerErr *ErrNotOwner
+	if assert.True(t, errors.As(err, &notOwnerErr), "unexpected error: %v", err) {
+		assert.Equal(t, Pid(os.Getpid()), notOwnerErr.Holder)
+		assert.Equal(t, Pid(1), notOwnerErr.Caller)
+	}
+
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+
+	assert.Nil(t, suite.pl.Unlock(0))
+	assert.Equal(t, os.ErrNotExist, suite.pl.Swap(SelfPid, 1))
+}
+
+// If we hold the lock, SendSignal should be able to signal us.
+func (suite *PidfileLockTestSuite) TestSendSignal() {
+	t := suite.T()
+
+	suite.makePidfile(true)
+
+	// Signal 0 checks that the process can be signalled without actually delivering anything.
+	assert.Nil(t, suite.pl.SendSignal(syscall.Signal(0)))
+}
+
+// If nobody holds the lock, SendSignal should have nobody to signal.
+func (suite *PidfileLockTestSuite) TestSendSignal_NotExist() {
+	t := suite.T()
+
+	assert.Equal(t, os.ErrNotExist, suite.pl.SendSignal(syscall.Signal(0)))
+}
+
+// A stale pidfile's pid may belong to an unrelated process, which must not be signalled.
+func (suite *PidfileLockTestSuite) TestSendSignal_Invalid() {
+	t := suite.T()
+
+	suite.makePidfile(false)
+
+	assert.Equal(t, os.ErrNotExist, suite.pl.SendSignal(syscall.Signal(0)))
+}
+
+// If the lock was taken on another host, SendSignal should refuse to signal the local process with the same pid.
+func (suite *PidfileLockTestSuite) TestSendSignal_ForeignHost() {
+	t := suite.T()
+
+	suite.writeForeignPidfile()
+
+	err := suite.pl.SendSignal(syscall.Signal(0))
+	var notOwnerErr *ErrNotOwner
+	if assert.True(t, errors.As(err, &notOwnerErr), "unexpected error: %v", err) {
+		assert.Equal(t, foreignHostname, notOwnerErr.Hostname)
+		assert.Equal(t, Pid(0), notOwnerErr.Caller)
+	}
+}
+
+// If we hold the lock, Touch should update the pidfile's mtime without changing the pid.
+func (suite *PidfileLockTestSuite) TestTouch() {
+	t := suite.T()
+
+	assert.Nil(t, suite.pl.Lock(0))
+
+	now := time.Now().Add(time.Hour)
+	suite.pl.opts.clock = fakeClock(now)
+	assert.Nil(t, suite.pl.Touch())
+
+	pid, mtime, err := suite.pl.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+	assert.True(t, now.Equal(mtime), "mtime %v, expected %v", mtime, now)
+}
+
+// If another process holds the lock, Touch should fail and leave the pidfile's mtime alone.
+func (suite *PidfileLockTestSuite) TestTouch_NotOwner() {
+	t := suite.T()
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	mtime := time.Now()
+	suite.writePidfile(1, mtime)
+
+	err := suite.pl.Touch()
+	assert.True(t, errors.As(err, new(*ErrNotOwner)), "unexpected error: %v", err)
+
+	_, after, err := suite.pl.Read()
+	assert.Nil(t, err)
+	assert.True(t, mtime.Equal(after))
+}
+
+// If nobody holds the lock, Touch should fail, even if there is a stale pidfile.
+func (suite *PidfileLockTestSuite) TestTouch_NotExist() {
+	t := suite.T()
+
+	assert.Equal(t, os.ErrNotExist, suite.pl.Touch())
+
+	suite.makePidfile(false)
+	assert.Equal(t, os.ErrNotExist, suite.pl.Touch())
+}
+
+// If we hold the lock, Relocate should move it to the new path, creating its directory, and the lock should be used
+// there from then on.
+func (suite *PidfileLockTestSuite) TestRelocate() {
+	t := suite.T()
+
+	newPath := filepath.Join(suite.base, "subdir", "moved.pid")
+
+	assert.Nil(t, suite.pl.Lock(0))
+	assert.Nil(t, suite.pl.Relocate(newPath))
+	assert.Equal(t, newPath, suite.pl.Path())
+	suite.assertPidfile(false)
+
+	pid, err := suite.pl.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(os.Getpid()), pid)
+
+	assert.Nil(t, suite.pl.Unlock(0))
+	_, err = os.Stat(newPath)
+	assert.True(t, os.IsNotExist(err), "relocated pidfile exists when it should not")
+}
+
+// If we do not hold the lock, Relocate should fail and leave the lock where it is.
+func (suite *PidfileLockTestSuite) TestRelocate_NotOwner() {
+	t := suite.T()
+
+	newPath := filepath.Join(suite.base, "moved.pid")
+
+	assert.Equal(t, os.ErrNotExist, suite.pl.Relocate(newPath))
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	suite.writePidfile(1, time.Now())
+	err := suite.pl.Relocate(newPath)
+	assert.True(t, errors.As(err, new(*ErrNotOwner)), "unexpected error: %v", err)
+	assert.Equal(t, suite.pidfilePath, suite.pl.Path())
+	suite.assertPidfile(true)
+}
+
+// If there is already a pidfile at the new path, Relocate should fail and leave the lock where it is.
+func (suite *PidfileLockTestSuite) TestRelocate_Exists() {
+	t := suite.T()
+
+	newPath := filepath.Join(suite.base, "moved.pid")
+	assert.Nil(t, ioutil.WriteFile(newPath, []byte("1"), os.FileMode(0644)))
+
+	assert.Nil(t, suite.pl.Lock(0))
+	err := suite.pl.Relocate(newPath)
+	assert.True(t, errors.Is(err, os.ErrExist), "unexpected error: %v", err)
+	suite.assertPidfile(true)
+}
+
+// If the old pidfile cannot be removed, Relocate should remove the new one, so that only one pidfile names us.
+func (suite *PidfileLockTestSuite) TestRelocate_CannotRemove() {
+	t := suite.T()
+
+	newPath := filepath.Join(suite.base, "moved.pid")
+	fs := &faultyFileSystem{removeErr: func(path string) error {
+		if path == suite.pidfilePath {
+			return syscall.EIO
+		}
+		return nil
+	}}
+	pl, err := NewLock(suite.pidfilePath, WithFileSystem(fs))
+	if err != nil {
+		t.Fatalf("failed to create PidfileLock: %v", err)
+	}
+
+	assert.Nil(t, pl.Lock(0))
+	assert.NotNil(t, pl.Relocate(newPath))
+	assert.Equal(t, suite.pidfilePath, pl.Path())
+	suite.assertPidfile(true)
+	_, err = os.Stat(newPath)
+	assert.True(t, os.IsNotExist(err), "relocated pidfile exists when it should not")
+}
+
+// Relocate should be safe to call while other goroutines use the lock, and they should always find it held, never
+// taking it themselves.
+func (suite *PidfileLockTestSuite) TestRelocate_Goroutines() {
+	t := suite.T()
+
+	paths := []string{suite.pidfilePath, filepath.Join(suite.base, "moved.pid")}
+	assert.Nil(t, suite.pl.Lock(0))
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			if err := suite.pl.Relocate(paths[i%2]); err != nil {
+				t.Errorf("failed to relocate lock: %v", err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				stale, err := suite.pl.IsStale()
+				assert.Nil(t, err)
+				assert.False(t, stale)
+				_, _, valid, err := suite.pl.Peek()
+				assert.Nil(t, err)
+				assert.True(t, valid)
+				pid, _, err := suite.pl.Read()
+				assert.Nil(t, err)
+				assert.Equal(t, Pid(os.Getpid()), pid)
+				held, err := suite.pl.QuickCheck()
+				assert.Nil(t, err)
+				assert.True(t, held)
+
+				// Lock should never take the lock in the moment between Relocate removing the old pidfile and
+				// switching to the new one.
+				err = suite.pl.Lock(0)
+				var heldErr *ErrLockHeld
+				assert.True(t, errors.As(err, &heldErr), "unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	suite.assertPidfile(true)
+	_, err := os.Stat(paths[1])
+	assert.True(t, os.IsNotExist(err), "relocated pidfile exists when it should not")
+}
+
+// DebugInfo should report the values behind a valid lock consistently with its verdict.
+func (suite *PidfileLockTestSuite) TestDebugInfo_Valid() {
+	t := suite.T()
+
+	suite.makePidfile(true)
+
+	info, err := suite.pl.DebugInfo()
+	assert.Nil(t, err)
+	suite.assertDebugInfo(info)
+	assert.True(t, info.Valid)
+}
+
+// DebugInfo should report the values behind an invalid lock consistently with its verdict.
+func (suite *PidfileLockTestSuite) TestDebugInfo_Invalid() {
+	t := suite.T()
+
+	suite.makePidfile(false)
+
+	info, err := suite.pl.DebugInfo()
+	assert.Nil(t, err)
+	suite.assertDebugInfo(info)
+	assert.False(t, info.Valid)
+}
+
+// If the pidfile does not exist, DebugInfo should fail.
+func (suite *PidfileLockTestSuite) TestDebugInfo_NotExist() {
+	t := suite.T()
+
+	_, err := suite.pl.DebugInfo()
+	assert.Equal(t, os.ErrNotExist, err)
+}
+
+func (suite *PidfileLockTestSuite) assertDebugInfo(info LockDebugInfo) {
+	t := suite.T()
+
+	st, err := os.Stat(suite.pidfilePath)
+	if err != nil {
+		t.Fatalf("failed to stat pidfile: %v", err)
+	}
+
+	assert.Equal(t, Pid(os.Getpid()), info.RecordedPid)
+	assert.True(t, st.ModTime().Equal(info.FileMtime))
+	assert.NotZero(t, info.ProcCreateRawMs)
+	assert.Equal(t, info.ProcCreateRawMs*int64(time.Millisecond), info.ProcCreateTime.UnixNano())
+	assert.Equal(t, info.ProcCreateTime.Before(info.FileMtime.Truncate(time.Millisecond)), info.Valid)
+}
@@ -0,0 +1,282 @@
+package pidfile
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// An Option configures a Pidfile or PidfileLock.
+type Option func(*options)
+
+type options struct {
+	fileMode       os.FileMode
+	preserveMode   bool
+	dirMode        os.FileMode
+	exactMode      bool
+	createDirs     bool
+	terminator     string
+	pidFormat      string
+	recordHostname bool
+	recordBootID   bool
+	sync           bool
+	writeAttempts  int
+	writeBackoff   time.Duration
+	retriable      []error
+	validityGrace  time.Duration
+	lockTTL        time.Duration
+	codec          PidfileCodec
+	meta           Meta
+	logger         func(event string, fields map[string]interface{})
+	fs             FileSystem
+	pollInterval   time.Duration
+	clock          Clock
+	checker        ProcessChecker
+	strictWrite    bool
+}
+
+func defaultOptions() options {
+	return options{
+		fileMode:      os.FileMode(0644),
+		dirMode:       os.FileMode(0755),
+		createDirs:    true,
+		writeAttempts: 1,
+		retriable:     []error{syscall.EAGAIN, syscall.ESTALE},
+		terminator:    "\n",
+		pollInterval:  100 * time.Millisecond,
+		clock:         realClock{},
+		checker:       gopsutilChecker{},
+		fs:            osFileSystem{},
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithFileMode sets the permissions with which the pidfile is written.  The default is 0644.
+func WithFileMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.fileMode = mode
+	}
+}
+
+// WithPreserveMode causes Write, when it replaces an existing pidfile, and Lock, when it replaces a stale one, to give
+// the new file the permissions of the one it replaces, so that a pidfile whose permissions an operator has changed
+// keeps them.  When there is no existing pidfile, the mode set by WithFileMode is used.  The default is false.
+func WithPreserveMode(preserve bool) Option {
+	return func(o *options) {
+		o.preserveMode = preserve
+	}
+}
+
+// WithDirMode sets the permissions with which any missing parent directories of the pidfile are created.  The default
+// is 0755.  Like os.MkdirAll, this is subject to the process's umask, unless WithExactMode is used.
+func WithDirMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.dirMode = mode
+	}
+}
+
+// WithExactMode causes the parent directories that Write creates for the pidfile to be given exactly the mode set by
+// WithDirMode, regardless of the process's umask.  By default, as with mkdir(2), the umask applies to them; with a
+// umask of 077, for example, they would be created with mode 0700, and other users could not read the pidfile.
+//
+// The pidfile itself is always given exactly the mode set by WithFileMode (or WithPreserveMode), since it is set with
+// chmod(2), so this option does not affect it.
+func WithExactMode(exact bool) Option {
+	return func(o *options) {
+		o.exactMode = exact
+	}
+}
+
+// WithCreateDirs controls whether writing the pidfile creates any missing parent directories.  The default is true.  If
+// false, writing the pidfile fails with an error satisfying errors.Is(err, os.ErrNotExist) when its directory is
+// missing; this is useful when the directory is managed by something else (e.g. tmpfiles.d) and should not be created
+// with the wrong owner or mode.
+func WithCreateDirs(create bool) Option {
+	return func(o *options) {
+		o.createDirs = create
+	}
+}
+
+// WithTerminator sets the string written after the pid in the pidfile.  The default is a single newline, which is what
+// most init systems and other tools that read pidfiles expect.  Read ignores whitespace around the pid regardless.  The
+// terminator must be empty or begin with whitespace, so that Read can tell where the pid ends; New returns an error
+// otherwise.
+func WithTerminator(t string) Option {
+	return func(o *options) {
+		o.terminator = t
+	}
+}
+
+// WithPidFormat sets the fmt format with which the pid is written, for consumers that expect a particular format; for
+// example, "%010d" writes the pid zero-padded to ten digits.  The format must contain exactly one decimal integer verb
+// (%d, with any flags, width, and precision), and must produce something that Read can parse, so the pid may not be
+// preceded by other text; New returns an error otherwise.  The default is "%d".  The format is not used by a codec set
+// with WithCodec.
+func WithPidFormat(format string) Option {
+	return func(o *options) {
+		o.pidFormat = format
+	}
+}
+
+// WithHostname controls whether the name of the host is recorded in the pidfile along with the pid.  The default is
+// false.
+//
+// This makes it safe to keep pidfiles on a filesystem shared by several hosts, such as NFS.  A lock recorded by another
+// host is never validated against a local process that happens to have the same pid; since its holder cannot be
+// inspected, it is always considered held.  Pidfiles without a hostname are treated as local.
+func WithHostname(record bool) Option {
+	return func(o *options) {
+		o.recordHostname = record
+	}
+}
+
+// WithBootID controls whether the ID of the current boot is recorded in the pidfile along with the pid.  The default
+// is false.
+//
+// Pids are reused after a reboot, so a pidfile left behind by a previous boot may name a live but unrelated process.
+// The comparison of the process's creation time against the pidfile's mtime usually catches this, but it can be fooled
+// by changes to the system clock.  A lock whose recorded boot ID differs from the current one is always considered
+// stale.  The boot ID is only available on Linux; elsewhere, or if it cannot be read, it is not recorded or checked.
+func WithBootID(record bool) Option {
+	return func(o *options) {
+		o.recordBootID = record
+	}
+}
+
+// WithSync controls whether the pidfile, and the directory that contains it, are flushed to stable storage before Write
+// (or Lock) returns.  The default is false, in which case a crash shortly after the pidfile is written may leave it
+// missing or empty.
+func WithSync(sync bool) Option {
+	return func(o *options) {
+		o.sync = sync
+	}
+}
+
+// WithWriteRetry causes Write and Lock to make up to attempts attempts to write the pidfile, as long as each fails with
+// a retriable error (see WithRetriableErrors), sleeping for backoff after the first failure and twice as long after
+// each subsequent one.  This helps on network and overlay filesystems, where writes can fail transiently.  The default
+// is a single attempt.
+func WithWriteRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.writeAttempts = attempts
+		o.writeBackoff = backoff
+	}
+}
+
+// WithRetriableErrors sets the errors on which WithWriteRetry retries a write; an error is retriable if errors.Is
+// matches it against any of errs.  The default is EAGAIN and ESTALE.
+func WithRetriableErrors(errs ...error) Option {
+	return func(o *options) {
+		o.retriable = errs
+	}
+}
+
+// WithValidityGrace allows a lock's holder to have been created up to d after the pidfile was written and still be
+// considered valid.  The default is zero: the holder must have been created before the pidfile was written.
+//
+// This is useful when a supervisor writes the pidfile on behalf of a child that it is just starting, and the child's
+// creation time may be recorded slightly later than the pidfile's mtime.
+func WithValidityGrace(d time.Duration) Option {
+	return func(o *options) {
+		o.validityGrace = d
+	}
+}
+
+// WithLockTTL treats a lock as a lease that expires d after the pidfile's mtime: once it has expired, the lock is not
+// held, whether or not its holder is still running.  A holder can renew its lease by calling Touch more often than
+// every d.  The default is zero, which means that locks do not expire.
+//
+// With a TTL, a lock whose holder cannot be inspected (for example, because it runs in another pid namespace) is
+// considered held until it expires, rather than causing an error.  This makes a lease usable even where process
+// introspection is not.
+//
+// Expiry is judged by comparing the pidfile's mtime with the current time as seen by the process checking the lock.  If
+// the pidfile is on a filesystem shared between hosts whose clocks disagree, or the holder cannot Touch it promptly, a
+// lock may expire while its holder still believes that it holds it; choose d with a wide margin.  TTLs do not apply to
+// locks created with NewFlockLock.
+func WithLockTTL(d time.Duration) Option {
+	return func(o *options) {
+		o.lockTTL = d
+	}
+}
+
+// WithCodec sets the PidfileCodec used to write and read the pidfile.  By default, the pid is written as a decimal
+// integer followed by the terminator (see WithTerminator), and any metadata is written on the following lines.
+func WithCodec(c PidfileCodec) Option {
+	return func(o *options) {
+		o.codec = c
+	}
+}
+
+// WithMeta sets metadata to be recorded in the pidfile along with the pid; see Pidfile.ReadMeta.  The keys used by this
+// package (see Meta) take precedence over those in meta.
+func WithMeta(meta Meta) Option {
+	return func(o *options) {
+		o.meta = meta
+	}
+}
+
+// WithLogger sets a function to be called when a PidfileLock makes a decision or changes the lock, which is useful for
+// diagnosing why a lock was or was not acquired.  The default is to log nothing.
+//
+// The events are "lock.acquired", "lock.adopted", "lock.released", "lock.handed_off", "lock.relocated",
+// "lock.stale_removed", and, each time the lock's validity is checked, "lock.holder_alive" or "lock.stale".  The fields
+// always include "path" and, where relevant, the pid recorded in the pidfile ("pid"), the pidfile's mtime ("mtime"),
+// and the holder's creation time ("create_time").  The logger may be called from several goroutines at once, and must
+// not call methods of the PidfileLock.
+func WithLogger(logger func(event string, fields map[string]interface{})) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithFileSystem sets the FileSystem on which the pidfile is kept.  The default is the operating system's filesystem;
+// this is mostly useful for tests, for example to inject faults.
+func WithFileSystem(fs FileSystem) Option {
+	return func(o *options) {
+		o.fs = fs
+	}
+}
+
+// WithPollInterval sets how often methods that wait for the lock (such as LockWithContext) check whether it has been
+// released.  The default, which is also used if d is not positive, is 100ms.
+func WithPollInterval(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.pollInterval = d
+		}
+	}
+}
+
+// WithClock sets the clock used to timestamp the pidfile when the lock is taken.  The default is the system clock; this
+// is mostly useful for tests.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithStrictWrite causes Write and Lock to refuse to record a pid, other than that of the current process, unless the
+// ProcessChecker (see WithProcessChecker) reports that a process with that pid is running.  Such a pidfile would be
+// stale as soon as it was written, which almost always indicates a bug.  The default is false.
+func WithStrictWrite(strict bool) Option {
+	return func(o *options) {
+		o.strictWrite = strict
+	}
+}
+
+// WithProcessChecker sets the ProcessChecker used to decide whether a lock is valid.  The default inspects processes
+// with gopsutil; SignalChecker is a lighter-weight alternative, and CreateTimeFunc allows process creation times to be
+// obtained some other way.  See ProcessChecker for when the default may be unsuitable.
+func WithProcessChecker(c ProcessChecker) Option {
+	return func(o *options) {
+		o.checker = c
+	}
+}
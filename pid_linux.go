@@ -0,0 +1,5 @@
+package pidfile
+
+// MaxPid is the largest pid that the platform can assign.  Linux never raises pid_max above PID_MAX_LIMIT, which is
+// 2^22 on 64-bit systems (and smaller on 32-bit ones), and pids are always less than pid_max.
+const MaxPid Pid = 1<<22 - 1
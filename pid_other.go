@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package pidfile
+
+import (
+	"math"
+)
+
+// MaxPid is the largest pid that the platform can assign.  Outside of Linux, we only know that pids fit in a Pid.
+const MaxPid Pid = math.MaxInt32
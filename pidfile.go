@@ -3,35 +3,80 @@ package pidfile
 
 import (
 	"bytes"
-	"fmt"
-	"io/ioutil"
+	"context"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"syscall"
 	"time"
 
-	"github.com/facebookgo/atomicfile"
 	"github.com/pkg/errors"
 )
 
 type Pid int32 // __S32_TYPE
 
+// SelfPid may be passed to methods that take a pid, such as Write and Lock, to mean the pid of the current process.  It
+// is 0, which is never the pid of a process that could hold a pidfile, so passing 0 has the same effect.
+const SelfPid Pid = 0
+
 type Pidfile interface {
 	Path() string
+	Dir() string
 	Write(Pid) error
 	Read() (Pid, time.Time, error)
+	ReadPid() (Pid, error)
+	ReadMeta() (Pid, Meta, time.Time, error)
+	ReadWithInfo() (Pid, ReadInfo, error)
+	Stat() (os.FileInfo, error)
+	Exists() (bool, error)
 }
 
 type pidfile struct {
 	path string
+	opts options
+	// readOnly is true iff the pidfile was opened with Open, and so may not be written.
+	readOnly bool
+}
+
+// A record is everything that a pidfile says about the process that wrote it.
+type record struct {
+	pid Pid
+	// hostname is the name of the host on which the pidfile was written, or empty if it was not recorded.
+	hostname string
+	// bootID identifies the boot of the host during which the pidfile was written, or is empty if it was not recorded.
+	bootID string
+	// meta is all of the metadata recorded in the pidfile, including hostname and bootID.
+	meta Meta
 }
 
 var _ Pidfile = (*pidfile)(nil)
 
 // New returns a Pidfile that can be used to inspect and manage the file at the given path.
-func New(path string) (Pidfile, error) {
+func New(path string, opts ...Option) (Pidfile, error) {
+	o := newOptions(opts)
+	if o.pidFormat != "" {
+		if err := checkPidFormat(o.pidFormat); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkTerminator(o.terminator); err != nil {
+		return nil, err
+	}
+
 	return &pidfile{
 		path: path,
+		opts: o,
+	}, nil
+}
+
+// Open returns a read-only Pidfile that can be used to inspect the file at the given path.  Its Write method always
+// fails with ErrReadOnly, so it never creates the pidfile or its parent directories.
+func Open(path string, opts ...Option) (Pidfile, error) {
+	return &pidfile{
+		path:     path,
+		opts:     newOptions(opts),
+		readOnly: true,
 	}, nil
 }
 
@@ -39,52 +84,393 @@ func (p *pidfile) Path() string {
 	return p.path
 }
 
-// Write the pidfile.  If pid is 0, the pid of the current process is used instead.
+// Dir returns the directory that contains the pidfile, which is where to watch for the pidfile being created or
+// removed.
+func (p *pidfile) Dir() string {
+	return filepath.Dir(p.path)
+}
+
+// Write the pidfile.  If pid is SelfPid, the pid of the current process is used instead.
 func (p *pidfile) Write(pid Pid) error {
-	if pid == 0 {
+	if p.readOnly {
+		return errors.Wrapf(ErrReadOnly, "cannot write pidfile: %v", p.path)
+	}
+	if pid == SelfPid {
 		pid = Pid(os.Getpid())
 	}
 
-	if err := os.MkdirAll(filepath.Dir(p.path), os.FileMode(0755)); err != nil {
-		return errors.Wrapf(err, "failed to create parent directories of pidfile: %v", p.path)
+	if err := checkWritePid(pid); err != nil {
+		return err
+	}
+	if err := p.checkAlive(pid); err != nil {
+		return err
+	}
+	if err := p.mkdirs(); err != nil {
+		return err
+	}
+
+	d, err := p.format(pid)
+	if err != nil {
+		return err
+	}
+
+	// Each attempt writes to a fresh temporary file, so it is safe to start over if we are interrupted.
+	return p.retryWrite(func() error {
+		return p.writeFile(d)
+	})
+}
+
+// create atomically creates the pidfile with the given pid, mtime, and mode, but only if it does not already exist.  If
+// it does, the error returned satisfies errors.Is(err, os.ErrExist).
+func (p *pidfile) create(pid Pid, mtime time.Time, mode os.FileMode) error {
+	if err := checkWritePid(pid); err != nil {
+		return err
+	}
+	if err := p.checkAlive(pid); err != nil {
+		return err
+	}
+	if err := p.mkdirs(); err != nil {
+		return err
+	}
+
+	d, err := p.format(pid)
+	if err != nil {
+		return err
+	}
+
+	return p.retryWrite(func() error {
+		return p.createFile(d, mtime, mode)
+	})
+}
+
+// retryWrite calls fn, which writes the pidfile, until it succeeds or fails with an error that is not retriable, or we
+// have made as many attempts as we have been asked to (see WithWriteRetry).  Interrupted writes are always retried.
+func (p *pidfile) retryWrite(fn func() error) error {
+	backoff := p.opts.writeBackoff
+	for attempt := 1; ; attempt++ {
+		err := retryEINTR(fn)
+		if err == nil || attempt >= p.opts.writeAttempts || !p.isRetriable(err) {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isRetriable returns true iff err matches one of the errors set by WithRetriableErrors.
+func (p *pidfile) isRetriable(err error) bool {
+	for _, target := range p.opts.retriable {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAlive returns an error if we have been asked to write only the pids of running processes (see WithStrictWrite)
+// and pid is not one.
+func (p *pidfile) checkAlive(pid Pid) error {
+	if !p.opts.strictWrite || pid == Pid(os.Getpid()) {
+		return nil
 	}
 
-	f, err := atomicfile.New(p.path, os.FileMode(0644))
+	_, exists, err := p.opts.checker.CreateTime(context.Background(), pid)
 	if err != nil {
-		return errors.Wrapf(err, "error opening pidfile: %v", p.path)
+		return errors.Wrapf(err, "failed to check whether process %d is running", pid)
+	}
+	if !exists {
+		return errors.Errorf("refusing to write pid %d to pidfile %v: no such process", pid, p.path)
+	}
+	return nil
+}
+
+// mkdirs creates the parent directories of the pidfile, if they do not already exist and we have been asked to.
+func (p *pidfile) mkdirs() error {
+	// We check for the parent directory before trying to create it because MkdirAll reports a symlink loop as an
+	// existing file rather than as ELOOP.
+	_, err := stat(p.opts.fs, filepath.Dir(p.path))
+	if err == nil {
+		return nil
+	}
+	if !p.opts.createDirs || !errors.Is(err, os.ErrNotExist) {
+		return p.writeError(err, "failed to stat parent directory of pidfile")
 	}
 
-	// If we don't make it to the graceful Close below, throw out anything we managed to get on disk.
-	defer func() {
-		_ = f.Abort()
-	}()
+	// Note which directories are missing, so that we can set their modes afterwards if asked to.
+	var missing []string
+	if p.opts.exactMode {
+		for dir := filepath.Dir(p.path); ; dir = filepath.Dir(dir) {
+			if _, err := stat(p.opts.fs, dir); err == nil || filepath.Dir(dir) == dir {
+				break
+			}
+			missing = append(missing, dir)
+		}
+	}
 
-	if _, err := fmt.Fprintf(f, "%d", os.Getpid()); err != nil {
-		return errors.Wrapf(err, "failed to write pid to pidfile: %v", p.path)
+	if err := retryEINTR(func() error {
+		return p.opts.fs.MkdirAll(filepath.Dir(p.path), p.opts.dirMode)
+	}); err != nil {
+		return p.writeError(err, "failed to create parent directories of pidfile")
 	}
 
-	if err := f.Close(); err != nil {
-		return errors.Wrapf(err, "failed to close pidfile: %v", p.path)
+	for _, dir := range missing {
+		if err := p.opts.fs.Chmod(dir, p.opts.dirMode); err != nil {
+			return p.writeError(err, "failed to set mode of parent directory of pidfile")
+		}
 	}
 	return nil
 }
 
-// Read the pidfile and its mtime.  If err != nil, returns zero-values for pid and mtime.
+// writeFile atomically replaces the contents of the pidfile with d.
+func (p *pidfile) writeFile(d []byte) error {
+	mode := p.opts.fileMode
+	if p.opts.preserveMode {
+		st, err := stat(p.opts.fs, p.path)
+		if err == nil {
+			mode = st.Mode().Perm()
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return p.writeError(err, "failed to stat pidfile")
+		}
+	}
+
+	if err := p.opts.fs.WriteFileAtomic(p.path, d, mode, p.opts.sync); err != nil {
+		return p.writeError(err, "failed to write pidfile")
+	}
+	return nil
+}
+
+// createFile creates the pidfile with contents d and the given mtime and mode, but only if it does not already exist.
+func (p *pidfile) createFile(d []byte, mtime time.Time, mode os.FileMode) error {
+	if err := p.opts.fs.CreateFileExclusive(p.path, d, mode, mtime, p.opts.sync); err != nil {
+		return p.writeError(err, "failed to create pidfile")
+	}
+	return nil
+}
+
+// writeError wraps err, which was returned while creating or writing the pidfile, with msg.  Errors that callers are
+// likely to want to handle specially become ErrCannotWrite or ErrBadPath.
+func (p *pidfile) writeError(err error, msg string) error {
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		return &ErrCannotWrite{Path: p.path, Err: errors.Cause(err)}
+	case errors.Is(err, syscall.ENAMETOOLONG), errors.Is(err, syscall.ELOOP):
+		return &ErrBadPath{Path: p.path, Err: errors.Cause(err)}
+	}
+	return errors.Wrapf(err, "%s: %v", msg, p.path)
+}
+
+// WriteTo writes pid to w exactly as Write would write it to a pidfile with the default options.  If pid is SelfPid,
+// the pid of the current process is used instead.
+func WriteTo(w io.Writer, pid Pid) error {
+	if pid == SelfPid {
+		pid = Pid(os.Getpid())
+	}
+	return textCodec{terminator: defaultOptions().terminator}.Encode(w, pid, nil)
+}
+
+// ReadFrom reads a pid from r, which should have the contents of a pidfile written with the default codec, following
+// the same rules as Read.  Any metadata is ignored.  Errors caused by the contents of r wrap ErrMalformedPidfile.
+func ReadFrom(r io.Reader) (Pid, error) {
+	pid, _, err := textCodec{}.Decode(r)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse pid")
+	}
+	return pid, nil
+}
+
+// format returns the contents of a pidfile recording the given pid, as encoded by the configured codec.
+func (p *pidfile) format(pid Pid) ([]byte, error) {
+	meta := Meta{}
+	for k, v := range p.opts.meta {
+		meta[k] = v
+	}
+	if p.opts.recordHostname {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get hostname")
+		}
+		meta["hostname"] = hostname
+	}
+	if p.opts.recordBootID {
+		// Where the boot ID is not available, the pidfile simply does not record one.
+		if id := readBootID(); id != "" {
+			meta["boot_id"] = id
+		}
+	}
+	if len(meta) == 0 {
+		meta = nil
+	}
+
+	var buf bytes.Buffer
+	if err := p.codec().Encode(&buf, pid, meta); err != nil {
+		return nil, errors.Wrapf(err, "failed to encode pidfile: %v", p.path)
+	}
+	return buf.Bytes(), nil
+}
+
+// codec returns the configured PidfileCodec, or the default one.
+func (p *pidfile) codec() PidfileCodec {
+	if p.opts.codec != nil {
+		return p.opts.codec
+	}
+	return textCodec{terminator: p.opts.terminator, pidFormat: p.opts.pidFormat}
+}
+
+// Read the pidfile and its mtime.  Whitespace around the pid, and anything after it on the same line, is ignored.  If
+// err != nil, returns zero-values for pid and mtime.
+//
+// If the pidfile does not exist, the error satisfies errors.Is(err, os.ErrNotExist); if it cannot be read for lack of
+// permission, errors.Is(err, os.ErrPermission); and if it is empty, errors.Is(err, ErrEmptyPidfile).
 func (p *pidfile) Read() (Pid, time.Time, error) {
-	d, err := ioutil.ReadFile(p.path)
+	rec, mtime, err := p.read()
+	return rec.pid, mtime, err
+}
+
+// ReadPid is like Read, but only returns the pid.  It does not stat the pidfile, so it works where the pidfile can be
+// read but its mtime cannot be obtained, and it is cheaper where stat is slow.
+func (p *pidfile) ReadPid() (Pid, error) {
+	d, err := readFile(p.opts.fs, p.path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to read pidfile: %v", p.path)
+	}
+
+	rec, err := p.decode(d)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse pid from pidfile: %v", p.path)
+	}
+	return rec.pid, nil
+}
+
+// ReadMeta is like Read, but also returns the metadata recorded in the pidfile.
+func (p *pidfile) ReadMeta() (Pid, Meta, time.Time, error) {
+	rec, mtime, err := p.read()
+	return rec.pid, rec.meta, mtime, err
+}
+
+// ReadInfo describes the pidfile read by ReadWithInfo.
+type ReadInfo struct {
+	// ModTime is the pidfile's mtime, as returned by Read.
+	ModTime time.Time
+	// Size is the length of the pidfile's contents, in bytes.
+	Size int
+	// Trimmed is true if the contents were not exactly what Write would have written for the same pid and metadata,
+	// so that parts of them (such as stray whitespace, a missing or extra trailing newline, or anything after the pid on
+	// its line) were ignored.  It usually means that the pidfile was written by some other program.
+	Trimmed bool
+}
+
+// ReadWithInfo is like Read, but also reports whether the contents of the pidfile had to be cleaned up to find the pid.
+func (p *pidfile) ReadWithInfo() (Pid, ReadInfo, error) {
+	rec, d, mtime, err := p.readData()
+	if err != nil {
+		return 0, ReadInfo{}, err
+	}
+
+	var buf bytes.Buffer
+	if err := p.codec().Encode(&buf, rec.pid, rec.meta); err != nil {
+		return 0, ReadInfo{}, errors.Wrapf(err, "failed to encode pidfile: %v", p.path)
+	}
+
+	return rec.pid, ReadInfo{
+		ModTime: mtime,
+		Size:    len(d),
+		Trimmed: !bytes.Equal(d, buf.Bytes()),
+	}, nil
+}
+
+// Stat returns information about the pidfile, such as its mtime.  If the pidfile does not exist, the error satisfies
+// errors.Is(err, os.ErrNotExist).
+func (p *pidfile) Stat() (os.FileInfo, error) {
+	st, err := stat(p.opts.fs, p.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to stat pidfile: %v", p.path)
+	}
+	return st, nil
+}
+
+// Exists reports whether the pidfile exists, without reading it.  It says nothing about whether the pidfile is valid or
+// even readable.  An error is returned only if the pidfile cannot be stat'd for some other reason than its absence.
+func (p *pidfile) Exists() (bool, error) {
+	if _, err := p.Stat(); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// read is like Read, but returns everything recorded in the pidfile.
+func (p *pidfile) read() (record, time.Time, error) {
+	rec, _, mtime, err := p.readData()
+	return rec, mtime, err
+}
+
+// readData is like read, but also returns the raw contents of the pidfile.
+func (p *pidfile) readData() (record, []byte, time.Time, error) {
+	d, err := readFile(p.opts.fs, p.path)
 	if err != nil {
-		return 0, time.Time{}, errors.Wrapf(err, "failed to read pidfile: %v", p.path)
+		return record{}, nil, time.Time{}, errors.Wrapf(err, "failed to read pidfile: %v", p.path)
 	}
 
-	st, err := os.Stat(p.path)
+	st, err := p.Stat()
 	if err != nil {
-		return 0, time.Time{}, errors.Wrapf(err, "failed to stat pidfile: %v", p.path)
+		return record{}, nil, time.Time{}, err
 	}
 
-	pid, err := strconv.Atoi(string(bytes.TrimSpace(d)))
+	rec, err := p.decode(d)
 	if err != nil {
-		return 0, time.Time{}, errors.Wrapf(err, "failed to parse pid from pidfile: %v", p.path)
+		return record{}, nil, time.Time{}, errors.Wrapf(err, "failed to parse pid from pidfile: %v", p.path)
 	}
 
-	return Pid(pid), st.ModTime(), nil
+	return rec, d, st.ModTime(), nil
+}
+
+// decode parses the contents of a pidfile, as written by format.
+func (p *pidfile) decode(d []byte) (record, error) {
+	if len(bytes.TrimSpace(d)) == 0 {
+		return record{}, ErrEmptyPidfile
+	}
+
+	pid, meta, err := p.codec().Decode(bytes.NewReader(d))
+	if err != nil {
+		return record{}, err
+	}
+	return record{
+		pid:      pid,
+		hostname: meta["hostname"],
+		bootID:   meta["boot_id"],
+		meta:     meta,
+	}, nil
+}
+
+// parsePid parses a pid from a pidfile.  The pid must be positive and no larger than MaxPid.  Errors wrap
+// ErrMalformedPidfile.
+func parsePid(d []byte) (Pid, error) {
+	s := string(bytes.TrimSpace(d))
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return 0, errors.Wrapf(ErrMalformedPidfile, "pidfile contains invalid pid %v", s)
+		}
+		return 0, errors.Wrapf(ErrMalformedPidfile, "pidfile contains non-numeric data %q", s)
+	}
+	return checkPid(n)
+}
+
+// checkPid returns n as a Pid if it is positive and no larger than MaxPid.  Errors wrap ErrMalformedPidfile.
+func checkPid(n int64) (Pid, error) {
+	if n <= 0 || n > int64(MaxPid) {
+		return 0, errors.Wrapf(ErrMalformedPidfile, "pidfile contains invalid pid %d", n)
+	}
+	return Pid(n), nil
+}
+
+// checkWritePid returns an error if pid could not belong to a process, so that we never write a pidfile that Read
+// would reject as malformed.
+func checkWritePid(pid Pid) error {
+	if _, err := checkPid(int64(pid)); err != nil {
+		return errors.Errorf("cannot record invalid pid %d", pid)
+	}
+	return nil
 }
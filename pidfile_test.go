@@ -1,9 +1,14 @@
 package pidfile
 
 import (
+	"bytes"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -44,6 +49,17 @@ func TestGetPath(t *testing.T) {
 	}
 }
 
+// Dir should return the directory that contains the pidfile, even for a relative path with no directory.
+func TestGetDir(t *testing.T) {
+	pidfile, err := New(filepath.Join("run", "myd", "myd.pid"))
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join("run", "myd"), pidfile.Dir())
+
+	pidfile, err = New("myd.pid")
+	assert.Nil(t, err)
+	assert.Equal(t, ".", pidfile.Dir())
+}
+
 func TestSimple(t *testing.T) {
 	pidfilePath := tempfilename(t)
 	defer func() {
@@ -61,6 +77,111 @@ func TestSimple(t *testing.T) {
 	assert.Equal(t, Pid(os.Getpid()), p)
 }
 
+// With WithCreateDirs(false), Write should fail rather than create missing directories.
+func TestNoCreateDirs(t *testing.T) {
+	dir := tempfilename(t)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	pidfilePath := filepath.Join(dir, "pidfile")
+
+	pidfile, err := New(pidfilePath, WithCreateDirs(false))
+	assert.Nil(t, err)
+
+	err = pidfile.Write(0)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+
+	// Once the directory exists, Write should succeed.
+	if err := os.Mkdir(dir, os.FileMode(0755)); err != nil {
+		t.Fatal(err)
+	}
+	err = pidfile.Write(0)
+	assert.Nil(t, err)
+}
+
+// If the pidfile was opened with Open, it should be readable but Write should fail without creating anything.
+func TestOpen(t *testing.T) {
+	dir := tempfilename(t)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	pidfilePath := filepath.Join(dir, "pidfile")
+
+	ro, err := Open(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, pidfilePath, ro.Path())
+
+	err = ro.Write(0)
+	assert.True(t, errors.Is(err, ErrReadOnly), "unexpected error: %v", err)
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err), "Write created the parent directory")
+
+	pidfile, err := New(pidfilePath)
+	assert.Nil(t, err)
+	assert.Nil(t, pidfile.Write(Pid(1234)))
+
+	p, _, err := ro.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1234), p)
+}
+
+// Stat should describe the pidfile that Read reads, and fail with os.ErrNotExist if there is none.
+func TestStat(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	pidfile, err := New(pidfilePath)
+	assert.Nil(t, err)
+
+	_, err = pidfile.Stat()
+	assert.True(t, errors.Is(err, os.ErrNotExist), "unexpected error: %v", err)
+
+	assert.Nil(t, pidfile.Write(Pid(1234)))
+
+	st, err := pidfile.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len("1234\n")), st.Size())
+
+	_, mtime, err := pidfile.Read()
+	assert.Nil(t, err)
+	assert.True(t, mtime.Equal(st.ModTime()))
+}
+
+// Exists should report whether the pidfile exists, whatever its contents, and report other errors.
+func TestExists(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	pidfile, err := New(pidfilePath)
+	assert.Nil(t, err)
+
+	exists, err := pidfile.Exists()
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	// A pidfile exists even if it cannot be parsed.
+	if err := ioutil.WriteFile(pidfilePath, []byte("notanumber"), os.FileMode(0644)); err != nil {
+		t.Fatal(err)
+	}
+	exists, err = pidfile.Exists()
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	// Other failures are reported.
+	pidfile, err = New(filepath.Join(pidfilePath, "pidfile"))
+	assert.Nil(t, err)
+	exists, err = pidfile.Exists()
+	assert.NotNil(t, err)
+	assert.False(t, exists)
+}
+
 func TestMakesDirectories(t *testing.T) {
 	dir := tempfilename(t)
 	defer func() {
@@ -76,3 +197,421 @@ func TestMakesDirectories(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, Pid(os.Getpid()), p)
 }
+
+// Errors returned through our wrapping layers should still be inspectable with the standard library's errors.Is and
+// errors.As.
+func TestErrorsUnwrap(t *testing.T) {
+	dir := tempfilename(t)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	pidfile, err := New(filepath.Join(dir, "pidfile"))
+	assert.Nil(t, err)
+
+	_, _, err = pidfile.Read()
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	var pathErr *os.PathError
+	assert.True(t, errors.As(err, &pathErr))
+
+	// Make the would-be parent directory a regular file so that Write cannot create the pidfile.
+	if err := ioutil.WriteFile(dir, nil, os.FileMode(0644)); err != nil {
+		t.Fatal(err)
+	}
+	err = pidfile.Write(0)
+	assert.True(t, errors.Is(err, syscall.ENOTDIR))
+}
+
+// If we lack permission to create the pidfile, Write should say so with ErrCannotWrite.
+func TestWrite_CannotWrite(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	dir := tempfilename(t)
+	if err := os.Mkdir(dir, os.FileMode(0555)); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	pidfile, err := New(filepath.Join(dir, "pidfile"))
+	assert.Nil(t, err)
+
+	err = pidfile.Write(0)
+	var cwErr *ErrCannotWrite
+	assert.True(t, errors.As(err, &cwErr))
+	assert.True(t, errors.Is(err, os.ErrPermission))
+}
+
+// Write should report a permission error when it cannot create the pidfile's parent directories.
+func TestWrite_CannotCreateDirs(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	dir := tempfilename(t)
+	if err := os.Mkdir(dir, os.FileMode(0555)); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	pidfile, err := New(filepath.Join(dir, "subdir", "pidfile"))
+	assert.Nil(t, err)
+
+	err = pidfile.Write(0)
+	var cwErr *ErrCannotWrite
+	assert.True(t, errors.As(err, &cwErr))
+	assert.True(t, errors.Is(err, os.ErrPermission))
+}
+
+// Write should report a path that is too long as ErrBadPath, preserving the underlying errno.
+func TestWrite_PathTooLong(t *testing.T) {
+	dir := tempfilename(t)
+	if err := os.Mkdir(dir, os.FileMode(0755)); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	pidfile, err := New(filepath.Join(dir, strings.Repeat("a", 5000)))
+	assert.Nil(t, err)
+
+	err = pidfile.Write(0)
+	var bpErr *ErrBadPath
+	assert.True(t, errors.As(err, &bpErr), "unexpected error: %v", err)
+	assert.True(t, errors.Is(err, syscall.ENAMETOOLONG))
+}
+
+// Write should report a path through a symlink loop as ErrBadPath, preserving the underlying errno.
+func TestWrite_SymlinkLoop(t *testing.T) {
+	dir := tempfilename(t)
+	if err := os.Mkdir(dir, os.FileMode(0755)); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	loop := filepath.Join(dir, "loop")
+	if err := os.Symlink(loop, loop); err != nil {
+		t.Skipf("cannot create symlink: %v", err)
+	}
+
+	for _, createDirs := range []bool{true, false} {
+		pidfile, err := New(filepath.Join(loop, "pidfile"), WithCreateDirs(createDirs))
+		assert.Nil(t, err)
+
+		err = pidfile.Write(0)
+		var bpErr *ErrBadPath
+		assert.True(t, errors.As(err, &bpErr), "unexpected error: %v", err)
+		assert.True(t, errors.Is(err, syscall.ELOOP))
+	}
+}
+
+// If we cannot read the pidfile, Read should say so rather than reporting that it does not exist.
+func TestRead_CannotRead(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	pidfile, err := New(pidfilePath, WithFileMode(os.FileMode(0)))
+	assert.Nil(t, err)
+	assert.Nil(t, pidfile.Write(0))
+
+	_, _, err = pidfile.Read()
+	assert.True(t, errors.Is(err, os.ErrPermission), "unexpected error: %v", err)
+	assert.False(t, errors.Is(err, os.ErrNotExist))
+}
+
+// Write should record the pid it is given rather than the pid of the current process.
+func TestWriteOtherPid(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	pidfile, err := New(pidfilePath)
+	assert.Nil(t, err)
+
+	err = pidfile.Write(Pid(99999))
+	assert.Nil(t, err)
+
+	p, _, err := pidfile.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(99999), p)
+}
+
+// By default, the pid should be followed by a newline; the terminator can be changed with WithTerminator, but not to one
+// that would stop Read from finding the end of the pid.
+func TestTerminator(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	for _, c := range []struct {
+		opts     []Option
+		expected string
+	}{
+		{nil, "1234\n"},
+		{[]Option{WithTerminator("")}, "1234"},
+		{[]Option{WithTerminator("\r\n")}, "1234\r\n"},
+	} {
+		pidfile, err := New(pidfilePath, c.opts...)
+		assert.Nil(t, err)
+
+		err = pidfile.Write(Pid(1234))
+		assert.Nil(t, err)
+
+		d, err := ioutil.ReadFile(pidfilePath)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, string(d))
+
+		p, _, err := pidfile.Read()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(1234), p)
+	}
+
+	_, err := New(pidfilePath, WithTerminator(";"))
+	assert.NotNil(t, err)
+	_, err = NewLock(pidfilePath, WithTerminator("x\n"))
+	assert.NotNil(t, err)
+}
+
+// With WithHostname, Write should record the host after the pid, whatever the terminator, and Read should still read
+// the pid.
+func TestHostname(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	hostname, err := os.Hostname()
+	assert.Nil(t, err)
+
+	for _, c := range []struct {
+		opts     []Option
+		expected string
+	}{
+		{[]Option{WithHostname(true)}, "1234\nhostname=" + hostname + "\n"},
+		{[]Option{WithHostname(true), WithTerminator("")}, "1234\nhostname=" + hostname + "\n"},
+		{[]Option{WithHostname(false)}, "1234\n"},
+	} {
+		pidfile, err := New(pidfilePath, c.opts...)
+		assert.Nil(t, err)
+
+		err = pidfile.Write(Pid(1234))
+		assert.Nil(t, err)
+
+		d, err := ioutil.ReadFile(pidfilePath)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, string(d))
+
+		p, _, err := pidfile.Read()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(1234), p)
+	}
+}
+
+// If asked to sync the pidfile, Write should still write it as usual.
+func TestSync(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	pidfile, err := New(pidfilePath, WithSync(true))
+	assert.Nil(t, err)
+
+	err = pidfile.Write(Pid(1234))
+	assert.Nil(t, err)
+
+	p, _, err := pidfile.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1234), p)
+}
+
+// WriteTo and ReadFrom should use the same format as a pidfile, without needing one on disk.
+func TestWriteToReadFrom(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, WriteTo(&buf, Pid(1234)))
+	assert.Equal(t, "1234\n", buf.String())
+
+	pid, err := ReadFrom(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1234), pid)
+
+	pid, err = ReadFrom(strings.NewReader("  4321\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(4321), pid)
+
+	_, err = ReadFrom(strings.NewReader("-1"))
+	assert.True(t, errors.Is(err, ErrMalformedPidfile), "unexpected error: %v", err)
+}
+
+// If the pidfile records a number that cannot be a pid, Read should report it as malformed.
+func TestReadInvalidPid(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	pidfile, err := New(pidfilePath)
+	assert.Nil(t, err)
+
+	for _, s := range []string{
+		"-1", "0", strconv.Itoa(int(MaxPid) + 1), "4294967296", "99999999999", "99999999999999999999999",
+	} {
+		if err := ioutil.WriteFile(pidfilePath, []byte(s), os.FileMode(0644)); err != nil {
+			t.Fatal(err)
+		}
+
+		p, _, err := pidfile.Read()
+		assert.Equal(t, Pid(0), p)
+		if assert.NotNil(t, err) {
+			assert.True(t, strings.Contains(err.Error(), "invalid pid "+s), "unexpected error: %v", err)
+		}
+		assert.True(t, errors.Is(err, ErrMalformedPidfile))
+	}
+}
+
+// If the pidfile is not numeric, Read should return ErrMalformedPidfile.
+func TestReadMalformed(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	if err := ioutil.WriteFile(pidfilePath, []byte("notanumber"), os.FileMode(0644)); err != nil {
+		t.Fatal(err)
+	}
+
+	pidfile, err := New(pidfilePath)
+	assert.Nil(t, err)
+
+	p, _, err := pidfile.Read()
+	assert.Equal(t, Pid(0), p)
+	assert.True(t, errors.Is(err, ErrMalformedPidfile))
+}
+
+// ReadWithInfo should report when the pidfile's contents are not exactly what Write would have written.
+func TestReadWithInfo(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	pidfile, err := New(pidfilePath)
+	assert.Nil(t, err)
+
+	assert.Nil(t, pidfile.Write(1234))
+	p, info, err := pidfile.ReadWithInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1234), p)
+	assert.False(t, info.Trimmed)
+	assert.Equal(t, 5, info.Size)
+	assert.False(t, info.ModTime.IsZero())
+
+	for _, s := range []string{"1234", " 1234\n", "1234\n\n", "1234 extra\n", "1234\r\n"} {
+		if err := ioutil.WriteFile(pidfilePath, []byte(s), os.FileMode(0644)); err != nil {
+			t.Fatal(err)
+		}
+
+		p, info, err := pidfile.ReadWithInfo()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(1234), p)
+		assert.True(t, info.Trimmed, "contents %q", s)
+		assert.Equal(t, len(s), info.Size)
+	}
+
+	if err := ioutil.WriteFile(pidfilePath, []byte("notanumber"), os.FileMode(0644)); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = pidfile.ReadWithInfo()
+	assert.True(t, errors.Is(err, ErrMalformedPidfile))
+}
+
+// The modes of the pidfile and any directories created for it should be configurable.
+func TestModes(t *testing.T) {
+	dir := tempfilename(t)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	pidfilePath := filepath.Join(dir, "pidfile")
+
+	pidfile, err := New(pidfilePath, WithFileMode(os.FileMode(0600)), WithDirMode(os.FileMode(0700)))
+	assert.Nil(t, err)
+
+	err = pidfile.Write(0)
+	assert.Nil(t, err)
+
+	st, err := os.Stat(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), st.Mode().Perm())
+
+	st, err = os.Stat(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0700), st.Mode().Perm())
+}
+
+// With WithPreserveMode, rewriting a pidfile should keep the permissions of the file it replaces.
+func TestModes_Preserve(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	pidfile, err := New(pidfilePath, WithPreserveMode(true))
+	assert.Nil(t, err)
+
+	// With no existing pidfile, the configured mode is used.
+	assert.Nil(t, pidfile.Write(0))
+	st, err := os.Stat(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0644), st.Mode().Perm())
+
+	if err := os.Chmod(pidfilePath, os.FileMode(0600)); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, pidfile.Write(0))
+	st, err = os.Stat(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), st.Mode().Perm())
+
+	// Without it, the configured mode is used regardless.
+	pidfile, err = New(pidfilePath)
+	assert.Nil(t, err)
+	assert.Nil(t, pidfile.Write(0))
+	st, err = os.Stat(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0644), st.Mode().Perm())
+}
+
+// By default, the pidfile should be world-readable.
+func TestModes_Default(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	pidfile, err := New(pidfilePath)
+	assert.Nil(t, err)
+
+	err = pidfile.Write(0)
+	assert.Nil(t, err)
+
+	st, err := os.Stat(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0644), st.Mode().Perm())
+}
@@ -0,0 +1,165 @@
+package pidfile
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/process"
+)
+
+// A ProcessChecker answers questions about running processes on behalf of a PidfileLock.
+//
+// A lock is valid only if its holder was created before the pidfile was written, which is how a stale pidfile whose pid
+// has been reused is detected.  That requires process creation times to be accurate.  In some environments they are
+// not: inside some containers and under WSL, for example, every process may appear to have been created when the
+// container started, or creation times may be unavailable.  There, the default checker can be replaced (see
+// WithProcessChecker) by one that uses a better source of creation times (see CreateTimeFunc), or by one that reports
+// none at all (such as SignalChecker), in which case the lock is valid for as long as any process with the recorded
+// pid is running and pid reuse goes undetected.
+//
+// Each method should give up and return an error once its context is done.  The context is context.Background() unless
+// the caller used a method such as HolderWithContext.
+type ProcessChecker interface {
+	// CreateTime returns the time at which the process with the given pid was created.  If no such process exists, it
+	// returns false and a nil error.  If the process exists but its creation time is unknown, it returns the zero time;
+	// the process is then assumed to predate any pidfile that names it.
+	CreateTime(ctx context.Context, pid Pid) (time.Time, bool, error)
+	// Cmdline returns the command line of the process with the given pid.
+	Cmdline(ctx context.Context, pid Pid) (string, error)
+}
+
+// gopsutilChecker is the default ProcessChecker.
+type gopsutilChecker struct{}
+
+var _ ProcessChecker = gopsutilChecker{}
+
+func (gopsutilChecker) CreateTime(ctx context.Context, pid Pid) (time.Time, bool, error) {
+	var createTime time.Time
+	var exists bool
+	err := runWithContext(ctx, func() error {
+		proc, err := process.NewProcessWithContext(ctx, int32(pid))
+		if err != nil {
+			if isProcessNotRunning(err) {
+				return nil
+			}
+			return errors.Wrap(err, "failed to get process information")
+		}
+
+		// XXX: The docs for this function say that it returns seconds, but it clearly returns milliseconds.
+		procCreateUnixMs, err := proc.CreateTimeWithContext(ctx)
+		if err != nil {
+			if isProcessNotRunning(err) {
+				return nil
+			}
+			return errors.Wrap(err, "failed to get process creation time")
+		}
+
+		createTime, exists = time.Unix(0, procCreateUnixMs*int64(time.Millisecond)), true
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return createTime, exists, nil
+}
+
+func (gopsutilChecker) Cmdline(ctx context.Context, pid Pid) (string, error) {
+	var cmdline string
+	err := runWithContext(ctx, func() error {
+		proc, err := process.NewProcessWithContext(ctx, int32(pid))
+		if err != nil {
+			return errors.Wrap(err, "failed to get process information")
+		}
+
+		cmdline, err = proc.CmdlineWithContext(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to get process command line")
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return cmdline, nil
+}
+
+// IsRunning reports whether a process with the given pid exists, as determined by the default ProcessChecker.  An error
+// is returned only if the process could not be inspected; a pid that is not in use, including one that is not positive,
+// is simply reported as not running.  Unlike Holder, IsRunning knows nothing of pidfiles, so it cannot tell whether the
+// process is the one that some pidfile refers to.
+func IsRunning(pid Pid) (bool, error) {
+	if pid <= 0 {
+		return false, nil
+	}
+	_, exists, err := gopsutilChecker{}.CreateTime(context.Background(), pid)
+	return exists, err
+}
+
+// runWithContext calls fn and returns its error, or returns ctx.Err() as soon as ctx is done if that happens first.
+// gopsutil reads procfs synchronously and so cannot be interrupted; if ctx ends first, fn is left to finish in the
+// background, and the caller must not look at anything that fn sets.
+func runWithContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SignalChecker is a ProcessChecker that only tests whether processes exist, without inspecting them further.  On Unix
+// it sends the null signal (kill(pid, 0)) rather than reading procfs.
+//
+// Because SignalChecker cannot tell when a process was created, a lock is considered valid as long as any process with
+// the recorded pid is running.  If the holder exits and its pid is reused by an unrelated process, the stale lock will
+// still be considered held.  This is acceptable for short-lived tools, where pid reuse during the lifetime of the lock
+// is unlikely, but the default checker should be preferred otherwise.
+type SignalChecker struct{}
+
+var _ ProcessChecker = SignalChecker{}
+
+func (SignalChecker) CreateTime(ctx context.Context, pid Pid) (time.Time, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, false, err
+	}
+	exists, err := processExists(pid)
+	if err != nil {
+		return time.Time{}, false, errors.Wrap(err, "failed to check whether process exists")
+	}
+	return time.Time{}, exists, nil
+}
+
+// Cmdline always returns the empty string; SignalChecker does not inspect processes.
+func (SignalChecker) Cmdline(ctx context.Context, pid Pid) (string, error) {
+	return "", nil
+}
+
+// CreateTimeFunc is a ProcessChecker that gets process creation times by calling the function, which must behave like
+// ProcessChecker.CreateTime.  Command lines are obtained as by the default checker.
+type CreateTimeFunc func(ctx context.Context, pid Pid) (time.Time, bool, error)
+
+var _ ProcessChecker = CreateTimeFunc(nil)
+
+func (f CreateTimeFunc) CreateTime(ctx context.Context, pid Pid) (time.Time, bool, error) {
+	return f(ctx, pid)
+}
+
+func (f CreateTimeFunc) Cmdline(ctx context.Context, pid Pid) (string, error) {
+	return gopsutilChecker{}.Cmdline(ctx, pid)
+}
+
+// isProcessNotRunning returns true iff err from gopsutil indicates that the process does not exist.  Besides gopsutil's
+// own sentinel, this depends on how the platform reports a missing process; see isProcessNotFound.
+func isProcessNotRunning(err error) bool {
+	return err == process.ErrorProcessNotRunning || isProcessNotFound(err)
+}
@@ -0,0 +1,98 @@
+package pidfile
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The default checker should report a process that does not exist as such, rather than as an error.
+func TestGopsutilChecker_NotExist(t *testing.T) {
+	// XXX: We assume that the maximum pid is well below this value.
+	ts, exists, err := gopsutilChecker{}.CreateTime(context.Background(), Pid(2147483644))
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	assert.Equal(t, time.Time{}, ts)
+}
+
+// The default checker should report the current process's creation time.
+func TestGopsutilChecker_Self(t *testing.T) {
+	ts, exists, err := gopsutilChecker{}.CreateTime(context.Background(), Pid(os.Getpid()))
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	assert.True(t, ts.Before(time.Now()))
+}
+
+// The default checker should give up once its context is done.
+func TestGopsutilChecker_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := gopsutilChecker{}.CreateTime(ctx, Pid(os.Getpid()))
+	assert.True(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+
+	_, err = gopsutilChecker{}.Cmdline(ctx, Pid(os.Getpid()))
+	assert.True(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+}
+
+// IsRunning should be true for the current process and false for pids that no process can have.
+func TestIsRunning(t *testing.T) {
+	running, err := IsRunning(Pid(os.Getpid()))
+	assert.Nil(t, err)
+	assert.True(t, running)
+
+	for _, pid := range []Pid{MaxPid, 0, -1} {
+		running, err := IsRunning(pid)
+		assert.Nil(t, err)
+		assert.False(t, running, "pid %d", pid)
+	}
+}
+
+// runWithContext should return when its context ends, even if the function it runs never does.
+func TestRunWithContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	block := make(chan struct{})
+	defer close(block)
+
+	err := runWithContext(ctx, func() error {
+		<-block
+		return nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+// A lock should be validated against the creation times reported by a CreateTimeFunc.
+func TestCreateTimeFunc(t *testing.T) {
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	var createTime time.Time
+	checker := CreateTimeFunc(func(ctx context.Context, pid Pid) (time.Time, bool, error) {
+		return createTime, pid == Pid(os.Getpid()), nil
+	})
+	l, err := NewLock(pidfilePath, WithProcessChecker(checker))
+	assert.Nil(t, err)
+	assert.Nil(t, l.Lock(0))
+
+	for _, c := range []struct {
+		createTime time.Time
+		held       bool
+	}{
+		{time.Now().Add(-time.Hour), true},
+		{time.Now().Add(time.Hour), false},
+		{time.Time{}, true}, // Unknown creation times are assumed to predate the pidfile.
+	} {
+		createTime = c.createTime
+		pid, err := l.Holder()
+		assert.Nil(t, err)
+		assert.Equal(t, c.held, pid != Pid(0), "create time %v", c.createTime)
+	}
+}
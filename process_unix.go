@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package pidfile
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// isProcessNotFound returns true iff err indicates that a process does not exist.  gopsutil reads procfs, so a missing
+// process usually shows up as a missing file.
+func isProcessNotFound(err error) bool {
+	return os.IsNotExist(errors.Cause(err)) || errors.Is(err, syscall.ESRCH)
+}
+
+// processExists reports whether a process with the given pid exists by sending it the null signal.
+func processExists(pid Pid) (bool, error) {
+	if pid <= 0 {
+		return false, nil
+	}
+
+	switch err := syscall.Kill(int(pid), syscall.Signal(0)); err {
+	case nil, syscall.EPERM:
+		// EPERM means that the process exists but belongs to someone else.
+		return true, nil
+	case syscall.ESRCH:
+		return false, nil
+	default:
+		return false, err
+	}
+}
@@ -0,0 +1,26 @@
+package pidfile
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/process"
+)
+
+// errorInvalidParameter is ERROR_INVALID_PARAMETER, which OpenProcess returns when there is no process with the given
+// pid.
+const errorInvalidParameter = syscall.Errno(87)
+
+// isProcessNotFound returns true iff err indicates that a process does not exist.  Windows has no procfs; gopsutil
+// opens a handle to the process instead, which fails with ERROR_INVALID_PARAMETER if the process has gone away.
+func isProcessNotFound(err error) bool {
+	return errors.Is(err, errorInvalidParameter)
+}
+
+// processExists reports whether a process with the given pid exists.  Windows has no null signal, so we ask gopsutil.
+func processExists(pid Pid) (bool, error) {
+	if pid <= 0 {
+		return false, nil
+	}
+	return process.PidExists(int32(pid))
+}
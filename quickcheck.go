@@ -0,0 +1,79 @@
+package pidfile
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// quickCheckMaxBytes bounds how much of the pidfile QuickCheck will read.  It is comfortably larger than a pidfile that
+// records a pid, hostname, and boot ID; pidfiles with a lot of other metadata (see WithMeta) cannot be quick-checked.
+const quickCheckMaxBytes = 4096
+
+// QuickCheck reports whether the lock appears to be held, doing as little work as possible: it opens the pidfile
+// (treating absence as "not held"), reads a bounded prefix of it, and checks whether a process with the recorded pid
+// exists (using kill(pid, 0) where available).
+//
+// QuickCheck trades correctness for throughput.  Unlike Holder, it does not compare the process's creation time against
+// the pidfile's mtime, so a stale pidfile whose pid has been reused by an unrelated process will be reported as held.
+// For the same reason, it ignores the lock's TTL (see WithLockTTL).  It is intended for hot paths such as
+// frequently-polled health checks; use Holder when the answer matters.
+//
+// As with Holder, a pidfile written on another host (see WithHostname) is always reported as held.
+func (p *pidfileLock) QuickCheck() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.useFlock {
+		// Checking for an advisory lock is already cheap, and unlike checking the process, it is correct.
+		held, err := flockHeld(p.path)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to check whether pidfile is locked")
+		}
+		return held, nil
+	}
+
+	var f io.ReadCloser
+	if err := retryEINTR(func() error {
+		var err error
+		f, err = p.opts.fs.Open(p.path)
+		return err
+	}); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to open pidfile: %v", p.path)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	buf := make([]byte, quickCheckMaxBytes)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, errors.Wrapf(err, "failed to read pidfile: %v", p.path)
+	}
+
+	rec, err := p.decode(buf[:n])
+	if errors.Is(err, ErrEmptyPidfile) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to parse pid from pidfile: %v", p.path)
+	}
+
+	local, err := isLocal(rec)
+	if err != nil {
+		return false, err
+	}
+	if !local {
+		return true, nil
+	}
+
+	alive, err := processExists(rec.pid)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check whether process exists")
+	}
+	return alive, nil
+}
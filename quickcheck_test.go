@@ -0,0 +1,115 @@
+package pidfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// In the common cases (no pidfile, or a pidfile written by a running process), QuickCheck should agree with Holder.
+func (suite *PidfileLockTestSuite) TestQuickCheck_MatchesHolder() {
+	t := suite.T()
+
+	for _, exists := range []bool{false, true} {
+		if exists {
+			suite.makePidfile(true)
+		}
+
+		held, err := suite.pl.QuickCheck()
+		assert.Nil(t, err)
+
+		pid, err := suite.pl.Holder()
+		assert.Nil(t, err)
+
+		assert.Equal(t, pid != Pid(0), held)
+		assert.Equal(t, exists, held)
+	}
+}
+
+// If the process named in the pidfile does not exist, QuickCheck should report that the lock is not held.
+func (suite *PidfileLockTestSuite) TestQuickCheck_NoProcess() {
+	t := suite.T()
+
+	// XXX: We assume that no process has the largest possible pid.
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte(fmt.Sprintf("%d", MaxPid)), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	held, err := suite.pl.QuickCheck()
+	assert.Nil(t, err)
+	assert.False(t, held)
+}
+
+// A pidfile written on another host is reported as held, whether or not a local process has the same pid.
+func (suite *PidfileLockTestSuite) TestQuickCheck_ForeignHost() {
+	t := suite.T()
+
+	d := fmt.Sprintf("%d\nhostname=%s\n", MaxPid, foreignHostname)
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte(d), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	held, err := suite.pl.QuickCheck()
+	assert.Nil(t, err)
+	assert.True(t, held)
+}
+
+// If the pidfile is not parseable, QuickCheck should fail.
+func (suite *PidfileLockTestSuite) TestQuickCheck_Malformed() {
+	t := suite.T()
+
+	if err := ioutil.WriteFile(suite.pidfilePath, []byte("garbage"), os.FileMode(0644)); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	_, err := suite.pl.QuickCheck()
+	assert.NotNil(t, err)
+}
+
+// benchmarkLock returns a lock held by the current process and a function that cleans it up.
+func benchmarkLock(b *testing.B) (PidfileLock, func()) {
+	dir, err := ioutil.TempDir("", "pidfile-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	path := filepath.Join(dir, "bench.pid")
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d", os.Getpid())), os.FileMode(0644)); err != nil {
+		b.Fatal(err)
+	}
+
+	l, err := NewLock(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return l, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func BenchmarkQuickCheck(b *testing.B) {
+	l, cleanup := benchmarkLock(b)
+	defer cleanup()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := l.QuickCheck(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHolder(b *testing.B) {
+	l, cleanup := benchmarkLock(b)
+	defer cleanup()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := l.Holder(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
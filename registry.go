@@ -0,0 +1,83 @@
+package pidfile
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// A Registry manages a group of pidfile locks that are taken and released together, such as one per tenant of a
+// multi-tenant daemon.
+type Registry interface {
+	// Add creates a PidfileLock for the pidfile at path and adds it to the group.  The lock is not taken.
+	Add(path string) (PidfileLock, error)
+	// LockAll takes every lock in the group, in the order in which they were added, on behalf of the process with the
+	// given pid.  If any lock cannot be taken, the locks that were already taken are released, and the error from the
+	// lock that failed is returned.
+	LockAll(pid Pid) error
+	// UnlockAll releases every lock in the group on behalf of the process with the given pid, in the reverse of the
+	// order in which they were added.  It tries to release every lock even if some cannot be released, and returns the
+	// first error.
+	UnlockAll(pid Pid) error
+}
+
+type registry struct {
+	opts []Option
+
+	mu    sync.Mutex
+	locks []PidfileLock
+}
+
+var _ Registry = (*registry)(nil)
+
+// NewRegistry returns an empty Registry.  The options are used to create each lock added to it.
+func NewRegistry(opts ...Option) Registry {
+	return &registry{opts: opts}
+}
+
+func (r *registry) Add(path string) (PidfileLock, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, l := range r.locks {
+		if l.Path() == path {
+			return nil, errors.Errorf("pidfile is already in the registry: %v", path)
+		}
+	}
+
+	l, err := NewLock(path, r.opts...)
+	if err != nil {
+		return nil, err
+	}
+	r.locks = append(r.locks, l)
+	return l, nil
+}
+
+func (r *registry) LockAll(pid Pid) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, l := range r.locks {
+		if err := l.Lock(pid); err != nil {
+			// Roll back, releasing the locks that we took in the reverse of the order in which we took them.
+			for j := i - 1; j >= 0; j-- {
+				_ = r.locks[j].Unlock(pid)
+			}
+			return errors.Wrapf(err, "failed to lock pidfile: %v", l.Path())
+		}
+	}
+	return nil
+}
+
+func (r *registry) UnlockAll(pid Pid) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for i := len(r.locks) - 1; i >= 0; i-- {
+		if err := r.locks[i].Unlock(pid); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "failed to unlock pidfile: %v", r.locks[i].Path())
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,87 @@
+package pidfile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// If a registry holds several locks, LockAll and UnlockAll should take and release all of them, and a path should only
+// be added once.
+func TestRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pidfile-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	r := NewRegistry()
+	var locks []PidfileLock
+	for _, name := range []string{"a.pid", "b.pid", "c.pid"} {
+		l, err := r.Add(filepath.Join(dir, name))
+		assert.Nil(t, err)
+		locks = append(locks, l)
+	}
+
+	_, err = r.Add(filepath.Join(dir, "b.pid"))
+	assert.NotNil(t, err)
+
+	assert.Nil(t, r.LockAll(0))
+	for _, l := range locks {
+		pid, err := l.Holder()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(os.Getpid()), pid)
+	}
+
+	assert.Nil(t, r.UnlockAll(0))
+	for _, l := range locks {
+		pid, err := l.Holder()
+		assert.Nil(t, err)
+		assert.Equal(t, Pid(0), pid)
+	}
+
+	// Releasing locks that are not held is an error.
+	assert.True(t, errors.Is(r.UnlockAll(0), os.ErrNotExist))
+}
+
+// If one lock cannot be taken, LockAll should release the ones that it already took.
+func TestRegistry_LockAllRollsBack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pidfile-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	r := NewRegistry()
+	a, err := r.Add(filepath.Join(dir, "a.pid"))
+	assert.Nil(t, err)
+	b, err := r.Add(filepath.Join(dir, "b.pid"))
+	assert.Nil(t, err)
+	c, err := r.Add(filepath.Join(dir, "c.pid"))
+	assert.Nil(t, err)
+
+	// XXX: We assume that pid 1 has been around for a long time.
+	assert.Nil(t, b.Lock(1))
+
+	err = r.LockAll(0)
+	var heldErr *ErrLockHeld
+	if assert.True(t, errors.As(err, &heldErr), "unexpected error: %v", err) {
+		assert.Equal(t, Pid(1), heldErr.Pid)
+	}
+
+	for _, l := range []PidfileLock{a, c} {
+		_, err := os.Stat(l.Path())
+		assert.True(t, os.IsNotExist(err), "%v: unexpected error: %v", l.Path(), err)
+	}
+	pid, err := b.Holder()
+	assert.Nil(t, err)
+	assert.Equal(t, Pid(1), pid)
+}
@@ -0,0 +1,86 @@
+package pidfile
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// A SignalDispatcher maps signals to actions on a lock (e.g. SIGTERM to unlock-and-exit, SIGHUP to a reload), running
+// them from a single goroutine.  Actions are run one at a time in the order their signals are received.
+type SignalDispatcher struct {
+	l PidfileLock
+
+	mu      sync.Mutex
+	actions map[os.Signal]func(PidfileLock)
+	sigCh   chan os.Signal
+	stopCh  chan struct{}
+	started bool
+	stopped bool
+}
+
+// NewSignalDispatcher returns a SignalDispatcher whose actions will be passed l.
+func NewSignalDispatcher(l PidfileLock) *SignalDispatcher {
+	return &SignalDispatcher{
+		l:       l,
+		actions: make(map[os.Signal]func(PidfileLock)),
+		sigCh:   make(chan os.Signal, 1),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// OnSignal arranges for action to be run when sig is received, replacing any action previously registered for sig.  It
+// may be called before or after Start.
+func (d *SignalDispatcher) OnSignal(sig os.Signal, action func(l PidfileLock)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.actions[sig] = action
+	if d.started && !d.stopped {
+		signal.Notify(d.sigCh, sig)
+	}
+}
+
+// Start begins handling the registered signals and returns a function that stops doing so.  The stop function may be
+// called more than once.
+func (d *SignalDispatcher) Start() (stop func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.started {
+		d.started = true
+		for sig := range d.actions {
+			signal.Notify(d.sigCh, sig)
+		}
+		go d.run()
+	}
+	return d.stop
+}
+
+func (d *SignalDispatcher) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopped {
+		return
+	}
+	d.stopped = true
+	signal.Stop(d.sigCh)
+	close(d.stopCh)
+}
+
+func (d *SignalDispatcher) run() {
+	for {
+		select {
+		case sig := <-d.sigCh:
+			d.mu.Lock()
+			action := d.actions[sig]
+			d.mu.Unlock()
+			if action != nil {
+				action(d.l)
+			}
+		case <-d.stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+//go:build !windows
+// +build !windows
+
+package pidfile
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Each signal should run the action registered for it.
+func TestSignalDispatcher(t *testing.T) {
+	path, cleanup := tempManagedLockPath(t)
+	defer cleanup()
+
+	l, err := NewLock(path)
+	assert.Nil(t, err)
+	assert.Nil(t, l.Lock(0))
+
+	refreshed := make(chan struct{}, 1)
+	released := make(chan error, 1)
+
+	d := NewSignalDispatcher(l)
+	d.OnSignal(syscall.SIGHUP, func(l PidfileLock) {
+		refreshed <- struct{}{}
+	})
+	d.OnSignal(syscall.SIGTERM, func(l PidfileLock) {
+		released <- l.Unlock(0)
+	})
+	stop := d.Start()
+	defer stop()
+
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SIGHUP action did not run")
+	}
+	assert.Equal(t, 0, len(released))
+
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	select {
+	case err := <-released:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SIGTERM action did not run")
+	}
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "pidfile exists when it should not")
+}
+
+// Stopping a dispatcher more than once should be harmless.
+func TestSignalDispatcher_Stop(t *testing.T) {
+	path, cleanup := tempManagedLockPath(t)
+	defer cleanup()
+
+	l, err := NewLock(path)
+	assert.Nil(t, err)
+
+	d := NewSignalDispatcher(l)
+	d.OnSignal(syscall.SIGHUP, func(l PidfileLock) {})
+	stop := d.Start()
+	stop()
+	stop()
+}
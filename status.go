@@ -0,0 +1,60 @@
+package pidfile
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Status is a snapshot of the state of a pidfile lock, suitable for reporting (for example, as JSON from a health
+// endpoint).
+type Status struct {
+	// Path is the path of the pidfile.
+	Path string `json:"path"`
+	// Exists is true iff the pidfile exists.  If it does not, the fields below are zero.
+	Exists bool `json:"exists"`
+	// Pid is the pid recorded in the pidfile.
+	Pid Pid `json:"pid,omitempty"`
+	// Mtime is the modification time of the pidfile.
+	Mtime time.Time `json:"mtime"`
+	// Valid is true iff the pidfile represents a valid lock.
+	Valid bool `json:"valid"`
+	// Holder describes the process that holds the lock, if Valid is true.
+	Holder *HolderInfo `json:"holder,omitempty"`
+}
+
+// Status reads the pidfile, decides whether it represents a valid lock, and reports the result.  It never changes the
+// pidfile.
+func (p *pidfileLock) Status() (Status, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := Status{Path: p.path}
+
+	rec, lockMtime, err := p.readLock()
+	if err != nil {
+		if isWrappedNotExist(err) {
+			return status, nil
+		}
+		return status, errors.Wrap(err, "failed to read pidfile")
+	}
+	status.Exists = true
+	status.Pid = rec.pid
+	status.Mtime = lockMtime
+
+	info, err := p.inspectLock(context.Background(), rec, lockMtime)
+	if err != nil {
+		return status, errors.Wrap(err, "failed to validate lock")
+	}
+	status.Valid = info.Valid
+	if !info.Valid {
+		return status, nil
+	}
+
+	status.Holder, err = p.describeHolder(context.Background(), rec, info)
+	if err != nil {
+		return status, err
+	}
+	return status, nil
+}
@@ -0,0 +1,55 @@
+package pidfile
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// If there's no pidfile, Status should report only its path.
+func (suite *PidfileLockTestSuite) TestStatus_NotExist() {
+	t := suite.T()
+
+	status, err := suite.pl.Status()
+	assert.Nil(t, err)
+	assert.Equal(t, Status{Path: suite.pidfilePath}, status)
+}
+
+// If the pidfile exists, Status should report what it records and whether it is valid, and should marshal as JSON.
+func (suite *PidfileLockTestSuite) TestStatus() {
+	t := suite.T()
+
+	for _, valid := range []bool{false, true} {
+		suite.makePidfile(valid)
+		st, err := os.Stat(suite.pidfilePath)
+		assert.Nil(t, err)
+
+		status, err := suite.pl.Status()
+		assert.Nil(t, err)
+		assert.Equal(t, suite.pidfilePath, status.Path)
+		assert.True(t, status.Exists)
+		assert.Equal(t, Pid(os.Getpid()), status.Pid)
+		assert.True(t, st.ModTime().Equal(status.Mtime))
+		assert.Equal(t, valid, status.Valid)
+		if valid {
+			if assert.NotNil(t, status.Holder) {
+				assert.Equal(t, Pid(os.Getpid()), status.Holder.Pid)
+			}
+		} else {
+			assert.Nil(t, status.Holder)
+		}
+
+		d, err := json.Marshal(status)
+		assert.Nil(t, err)
+		var fields map[string]interface{}
+		assert.Nil(t, json.Unmarshal(d, &fields))
+		if valid {
+			holder, _ := fields["holder"].(map[string]interface{})
+			assert.Equal(t, float64(os.Getpid()), holder["pid"])
+			assert.Contains(t, holder, "create_time")
+			assert.Contains(t, holder, "cmdline")
+			assert.NotContains(t, holder, "hostname")
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package pidfile
+
+import (
+	"os"
+)
+
+// syncDir flushes the directory at the given path to stable storage.
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+	return d.Sync()
+}
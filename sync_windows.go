@@ -0,0 +1,6 @@
+package pidfile
+
+// syncDir does nothing.  Windows cannot open a directory as a file, and NTFS journals directory entries itself.
+func syncDir(path string) error {
+	return nil
+}
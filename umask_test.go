@@ -0,0 +1,84 @@
+//go:build !windows
+// +build !windows
+
+package pidfile
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The pidfile should always have exactly the requested mode, and with WithExactMode, so should the directories created
+// for it, whatever the umask.
+func TestModes_Umask(t *testing.T) {
+	oldUmask := syscall.Umask(077)
+	defer syscall.Umask(oldUmask)
+
+	dir := tempfilename(t)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	for _, exact := range []bool{false, true} {
+		pidfilePath := filepath.Join(dir, "a", "b", "pidfile")
+		pidfile, err := New(pidfilePath, WithExactMode(exact))
+		assert.Nil(t, err)
+		assert.Nil(t, pidfile.Write(0))
+
+		st, err := os.Stat(pidfilePath)
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0644), st.Mode().Perm())
+
+		expectedDirMode := os.FileMode(0700)
+		if exact {
+			expectedDirMode = os.FileMode(0755)
+		}
+		for _, d := range []string{dir, filepath.Join(dir, "a"), filepath.Join(dir, "a", "b")} {
+			st, err := os.Stat(d)
+			assert.Nil(t, err)
+			assert.Equal(t, expectedDirMode, st.Mode().Perm(), "exact: %v, dir: %v", exact, d)
+		}
+
+		assert.Nil(t, os.RemoveAll(dir))
+	}
+}
+
+// Lock should give the pidfile exactly the requested mode whatever the umask, whether or not it uses flock; but with
+// WithPreserveMode, a flock-based lock should keep the mode of the pidfile that it finds.
+func TestLockModes_Umask(t *testing.T) {
+	oldUmask := syscall.Umask(077)
+	defer syscall.Umask(oldUmask)
+
+	pidfilePath := tempfilename(t)
+	defer func() {
+		_ = os.Remove(pidfilePath)
+	}()
+
+	for _, newLock := range []func(string, ...Option) (PidfileLock, error){NewLock, NewFlockLock} {
+		l, err := newLock(pidfilePath)
+		assert.Nil(t, err)
+		assert.Nil(t, l.Lock(0))
+
+		st, err := os.Stat(pidfilePath)
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0644), st.Mode().Perm())
+
+		assert.Nil(t, l.Unlock(0))
+	}
+
+	pidfile, err := New(pidfilePath, WithFileMode(0600))
+	assert.Nil(t, err)
+	assert.Nil(t, pidfile.Write(0))
+	l, err := NewFlockLock(pidfilePath, WithPreserveMode(true))
+	assert.Nil(t, err)
+	assert.Nil(t, l.Lock(0))
+
+	st, err := os.Stat(pidfilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), st.Mode().Perm())
+	assert.Nil(t, l.Unlock(0))
+}